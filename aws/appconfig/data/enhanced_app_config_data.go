@@ -7,7 +7,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/appconfigdata"
 	"github.com/aws/aws-xray-sdk-go/xray"
 	"os"
-	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -19,7 +18,6 @@ import (
 	"github.com/hxy1991/sdk-go/cache"
 	"github.com/hxy1991/sdk-go/constant"
 	"github.com/hxy1991/sdk-go/log"
-	"github.com/hxy1991/sdk-go/ticker"
 )
 
 const (
@@ -48,8 +46,7 @@ type EnhancedAppConfig struct {
 
 	appConfigClient     *appconfig.AppConfig
 	appConfigDataClient *appconfigdata.AppConfigData
-	cache               *cache.Cache
-	cacheRefreshTicker  *ticker.Ticker
+	cache               *cache.Typed[string, *EnhancedConfiguration]
 }
 
 type EnhancedConfiguration struct {
@@ -140,10 +137,18 @@ func NewWithOptions(ctx context.Context, opts ...Option) (*EnhancedAppConfig, er
 }
 
 func (appConfig *EnhancedAppConfig) initCache() {
-	log.Info("start init cache and ticker, cacheLimit: ", appConfig.cacheLimit, ", cacheRefreshInterval: ", appConfig.cacheRefreshInterval)
-	appConfig.cache = cache.New(appConfig.cacheLimit)
-	appConfig.initRefreshCacheTicker()
-	log.Info("init cache and ticker end")
+	log.Info("start init cache, cacheLimit: ", appConfig.cacheLimit, ", cacheRefreshInterval: ", appConfig.cacheRefreshInterval)
+	appConfig.cache = cache.NewTyped[string, *EnhancedConfiguration](
+		appConfig.cacheLimit,
+		cache.WithEvictionPolicy(cache.LRU),
+		cache.WithOnEvict(func(key string, _ *EnhancedConfiguration, reason cache.EvictionReason) {
+			if reason == cache.ReasonCapacity {
+				log.Warn("exceed the cache limit [", appConfig.cacheLimit, "] delete key [", key, "]")
+			}
+		}),
+		cache.WithRefresh(appConfig.cacheRefreshInterval, appConfig.refresh),
+	)
+	log.Info("init cache end")
 }
 
 func (appConfig *EnhancedAppConfig) initAppConfigClient() error {
@@ -194,92 +199,64 @@ func (appConfig *EnhancedAppConfig) initAppConfigDataClient() error {
 	return nil
 }
 
-func (appConfig *EnhancedAppConfig) initRefreshCacheTicker() {
-	cacheRefreshFunc := func() {
-		var ctx context.Context
-		if appConfig.isXRayEnable {
-			_ctx, segment := xray.BeginSegment(context.Background(), "EnhancedAppConfig-CacheRefresh")
-			defer segment.Close(nil)
-
-			ctx = _ctx
-		} else {
-			ctx = context.Background()
-		}
+// refresh is the refresher of the cache, it keeps the cached configuration if it has not changed
+// and removes it once the configuration profile no longer exists.
+func (appConfig *EnhancedAppConfig) refresh(ctx context.Context, key string, value *EnhancedConfiguration) (*EnhancedConfiguration, error) {
+	if appConfig.isXRayEnable {
+		_ctx, segment := xray.BeginSegment(ctx, "EnhancedAppConfig-CacheRefresh")
+		defer segment.Close(nil)
 
-		startTime := time.Now()
-		log.Debug("start refresh all the caches")
-		var refreshCacheWaitGroup sync.WaitGroup
-		for _, keyI := range appConfig.cache.Keys() {
-			refreshCacheWaitGroup.Add(1)
-			// 多协程并发获取
-			appConfig.refreshKey(ctx, &refreshCacheWaitGroup, keyI)
-		}
-		refreshCacheWaitGroup.Wait()
-		log.Debug("end refresh all the caches, cost: ", time.Since(startTime))
+		ctx = _ctx
 	}
 
-	appConfig.cacheRefreshTicker = ticker.New(appConfig.cacheRefreshInterval, cacheRefreshFunc)
-	appConfig.cacheRefreshTicker.Start()
-}
-
-func (appConfig *EnhancedAppConfig) refreshKey(ctx context.Context, refreshCacheWaitGroup *sync.WaitGroup, keyI interface{}) {
-	go func() {
-		defer func() {
-			refreshCacheWaitGroup.Done()
-			if e := recover(); e != nil {
-				stack := string(debug.Stack())
-				fmt.Println(stack)
-				fmt.Println(e)
-			}
-		}()
-
-		key := keyI.(string)
-		appConfig.Refresh(ctx, key)
-	}()
-
-}
-
-func (appConfig *EnhancedAppConfig) Refresh(ctx context.Context, key string) {
 	log.Debug("start refresh cache [", key, "]")
-	valueI, found := appConfig.cache.Get(key)
-	if !found {
-		return
-	}
-	if valueI == nil {
-		log.Warn("refresh cache [", key, "] fail, valueI is nil, cache has been removed")
-		return
+	if value == nil {
+		log.Warn("refresh cache [", key, "] fail, value is nil, cache has been removed")
+		return nil, cache.ErrDeleteEntry
 	}
 
-	nextPollConfigurationToken := valueI.(*EnhancedConfiguration).NextPollConfigurationToken
-	configuration, err := appConfig.getConfigurationWithToken(ctx, key, nextPollConfigurationToken)
+	configuration, err := appConfig.getConfigurationWithToken(ctx, key, value.NextPollConfigurationToken)
 	if err != nil {
 		if strings.Contains(err.Error(), "could not be found for account") {
 			log.Warn("refresh cache [", key, "] fail, configuration profile not exist, ", err)
 			// 配置不存在了，删除缓存
-			appConfig.cache.Delete(key)
-			return
+			return nil, cache.ErrDeleteEntry
 		}
-		log.Error("refresh cache [", key, "] error ", err)
-		return
+		return nil, err
 	}
 
 	if configuration == nil {
-		msg := fmt.Sprintf("get from aws app config failed [%s]", key)
-		log.Error(msg)
-		return
+		return nil, fmt.Errorf("get from aws app config failed [%s]", key)
 	}
 
-	if configuration.Content == nil {
+	if configuration.Content == nil || len(*configuration.Content) == 0 || *configuration.Content == *value.Content {
 		log.Debug("cache not change of configuration [", key, "]")
-	} else {
-		if *configuration.Content == *valueI.(*EnhancedConfiguration).Content {
-			log.Debug("cache not change of configuration [", key, "]")
-		} else {
-			log.Warn("cache change of configuration [", key, "]")
-			appConfig.cache.Add(key, configuration)
-		}
-	}
+		// the next poll must use the new token
+		return &EnhancedConfiguration{
+			Content:                    value.Content,
+			IsCache:                    value.IsCache,
+			CacheAt:                    value.CacheAt,
+			NextPollConfigurationToken: configuration.NextPollConfigurationToken,
+		}, nil
+	}
+
+	log.Warn("cache change of configuration [", key, "]")
+	configuration.IsCache = true
+	configuration.CacheAt = time.Now().Unix()
 	log.Debug("end refresh cache [", key, "]")
+	return configuration, nil
+}
+
+// Refresh refreshes the cached configuration right away instead of waiting for the refresh interval.
+func (appConfig *EnhancedAppConfig) Refresh(ctx context.Context, key string) {
+	if appConfig.cache == nil {
+		return
+	}
+
+	err := appConfig.cache.Refresh(ctx, key)
+	if err != nil {
+		log.Error("refresh cache [", key, "] error ", err)
+	}
 }
 
 func (appConfig *EnhancedAppConfig) GetConfiguration(ctx context.Context, configurationName string) (string, error) {
@@ -291,42 +268,45 @@ func (appConfig *EnhancedAppConfig) GetConfiguration(ctx context.Context, config
 }
 
 func (appConfig *EnhancedAppConfig) GetEnhancedConfiguration(ctx context.Context, configurationName string) (*EnhancedConfiguration, error) {
-	// get from cache if cache is on
-	if appConfig.cache != nil {
-		cacheValue, found := appConfig.cache.Get(configurationName)
-		if found {
-			if cacheValue != nil {
-				configuration := cacheValue.(*EnhancedConfiguration)
-				return configuration, nil
-			}
-			log.Warn("get configuration from cache, but the value of cache is nil ", configurationName)
-		}
+	if appConfig.cache == nil {
+		return appConfig.GetEnhancedConfigurationIgnoreCache(ctx, configurationName)
 	}
 
-	configuration, err := appConfig.getConfigurationWithToken(ctx, configurationName, nil)
-	if err != nil {
-		return nil, err
-	}
+	// get from cache, concurrent misses of the same configuration share one request to aws
+	isLoaded := false
+	configuration, err := appConfig.cache.GetOrLoad(ctx, configurationName, func(ctx context.Context) (*EnhancedConfiguration, error) {
+		isLoaded = true
 
-	if configuration == nil || configuration.Content == nil {
-		msg := fmt.Sprintf("get from aws app config failed [%s]", configurationName)
-		log.Error(msg)
-		return nil, errors.New(msg)
-	}
+		configuration, err := appConfig.getConfigurationWithToken(ctx, configurationName, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if configuration == nil || configuration.Content == nil {
+			msg := fmt.Sprintf("get from aws app config failed [%s]", configurationName)
+			log.Error(msg)
+			return nil, errors.New(msg)
+		}
 
-	// add to cache if cache is on
-	if appConfig.cache != nil {
 		log.Debug("add to cache ", configurationName)
 		configuration.IsCache = true
 		configuration.CacheAt = time.Now().Unix()
-		appConfig.cache.Add(configurationName, configuration)
+		return configuration, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &EnhancedConfiguration{
-		NextPollConfigurationToken: configuration.NextPollConfigurationToken,
-		Content:                    configuration.Content,
-		IsCache:                    false,
-	}, nil
+	if isLoaded {
+		// 本次是从 aws 获取的，不是从缓存中获取的
+		return &EnhancedConfiguration{
+			NextPollConfigurationToken: configuration.NextPollConfigurationToken,
+			Content:                    configuration.Content,
+			IsCache:                    false,
+		}, nil
+	}
+
+	return configuration, nil
 }
 
 func (appConfig *EnhancedAppConfig) GetConfigurationIgnoreCache(ctx context.Context, configurationName string) (string, error) {
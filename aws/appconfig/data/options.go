@@ -61,10 +61,9 @@ func WithIsCache(isCache bool) Option {
 		if appConfig.cache != nil {
 			if !isCache {
 				// 原先开启缓存，现在关闭缓存
+				appConfig.cache.Close()
 				appConfig.cache = nil
-				appConfig.cacheRefreshTicker.Stop()
-				appConfig.cacheRefreshTicker = nil
-				log.Warn("cacheRefreshTicker has been stopped and cache has been shut down")
+				log.Warn("cache refresh has been stopped and cache has been shut down")
 			}
 		} else {
 			if isCache {
@@ -112,8 +111,8 @@ func WithCacheRefreshInterval(cacheRefreshInterval time.Duration) Option {
 
 		if appConfig.cache != nil {
 			if cacheRefreshInterval != 0 {
-				oldInterval := appConfig.cacheRefreshTicker.Reset(cacheRefreshInterval)
-				log.Warn("reset refresh cache ticker interval from ", oldInterval, " to ", cacheRefreshInterval)
+				oldInterval := appConfig.cache.UpdateRefreshInterval(cacheRefreshInterval)
+				log.Warn("reset cache refresh interval from ", oldInterval, " to ", cacheRefreshInterval)
 			}
 		}
 		return nil
@@ -60,7 +60,7 @@ func TestAppConfig_GetConfiguration(t *testing.T) {
 			assert.True(t, (err != nil) == tt.wantErr, "CreateConfiguration() error = %v, wantErr %v", err, tt.wantErr)
 			assert.True(t, isSuccess, "CreateConfiguration() fail")
 
-			time.Sleep(appConfig.cacheRefreshTicker.Interval() + appConfig.timeout)
+			time.Sleep(appConfig.cache.RefreshInterval() + appConfig.timeout)
 
 			// 查询，从缓存中获取
 			got, err := appConfig.GetConfiguration(context.TODO(), tt.args.configurationName)
@@ -155,7 +155,6 @@ func TestAppConfig_UpdateIsCache(t *testing.T) {
 	assert.Nil(t, err)
 
 	assert.Nil(t, appConfig.cache)
-	assert.Nil(t, appConfig.cacheRefreshTicker)
 
 	// from aws app config
 	getConfiguration(t, appConfig, configurationName, false)
@@ -165,7 +164,6 @@ func TestAppConfig_UpdateIsCache(t *testing.T) {
 	assert.Nil(t, err)
 
 	assert.NotNil(t, appConfig.cache)
-	assert.NotNil(t, appConfig.cacheRefreshTicker)
 
 	// from aws app config
 	getConfiguration(t, appConfig, configurationName, false)
@@ -194,7 +192,7 @@ func TestAppConfig_UpdateCacheRefreshInterval(t *testing.T) {
 	err = appConfig.ApplyWithOptions(WithCacheRefreshInterval(newCacheRefreshInterval))
 	assert.Nil(t, err)
 
-	assert.Equal(t, newCacheRefreshInterval, appConfig.cacheRefreshTicker.Interval(), "they should be equal")
+	assert.Equal(t, newCacheRefreshInterval, appConfig.cache.RefreshInterval(), "they should be equal")
 
 	// from cache
 	getConfiguration(t, appConfig, configurationName, true)
@@ -275,7 +273,6 @@ func TestAppConfig_GetOptions(t *testing.T) {
 
 	assert.NotNil(t, appConfig1)
 	assert.NotNil(t, appConfig1.cache)
-	assert.NotNil(t, appConfig1.cacheRefreshTicker)
 
 	assert.Equal(t, appConfig1.regionName, regionName, "they should be equal")
 	assert.Equal(t, appConfig1.applicationName, applicationName, "they should be equal")
@@ -296,7 +293,6 @@ func TestAppConfig_GetOptions(t *testing.T) {
 
 	assert.NotNil(t, appConfig2)
 	assert.Nil(t, appConfig2.cache)
-	assert.Nil(t, appConfig2.cacheRefreshTicker)
 
 	assert.Equal(t, appConfig2.regionName, oregonRegionName, "they should be equal")
 	assert.Equal(t, appConfig2.applicationName, applicationName, "they should be equal")
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LocalBackend is a Backend in the memory of the process, for a single instance or the tests.
+type LocalBackend struct {
+	// mu makes SetNX atomic with the other writes
+	mu    sync.Mutex
+	cache *Typed[string, []byte]
+}
+
+// NewLocalBackend keeps at most cacheLimit values, opts are those of the underlying Typed cache.
+func NewLocalBackend(cacheLimit int64, opts ...Option) *LocalBackend {
+	return &LocalBackend{
+		cache: NewTyped[string, []byte](cacheLimit, opts...),
+	}
+}
+
+func (b *LocalBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, found := b.cache.Get(key)
+	return value, found, nil
+}
+
+// Set stores the value, a ttl <= 0 means the value never expires.
+func (b *LocalBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cache.AddWithTTL(key, value, ttl)
+	return nil
+}
+
+// SetNX stores the value only if the key does not exist, and reports whether it was stored.
+func (b *LocalBackend) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, found := b.cache.Get(key); found {
+		return false, nil
+	}
+	b.cache.AddWithTTL(key, value, ttl)
+	return true, nil
+}
+
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cache.Delete(key)
+	return nil
+}
+
+func (b *LocalBackend) Close() {
+	b.cache.Close()
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalBackend(t *testing.T) {
+	b := NewLocalBackend(10)
+	defer b.Close()
+	ctx := context.TODO()
+
+	if _, found, _ := b.Get(ctx, "a"); found {
+		t.Errorf("expected %v, but received %v", false, found)
+	}
+
+	_ = b.Set(ctx, "a", []byte("1"), 0)
+	value, found, err := b.Get(ctx, "a")
+	if err != nil || !found || string(value) != "1" {
+		t.Errorf("expected %v, but received %v %v %v", "1", string(value), found, err)
+	}
+
+	stored, _ := b.SetNX(ctx, "a", []byte("2"), 0)
+	if stored {
+		t.Errorf("expected %v, but received %v", false, stored)
+	}
+	stored, _ = b.SetNX(ctx, "b", []byte("2"), time.Millisecond*10)
+	if !stored {
+		t.Errorf("expected %v, but received %v", true, stored)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	if _, found, _ := b.Get(ctx, "b"); found {
+		t.Errorf("expected the expired value to be gone")
+	}
+	stored, _ = b.SetNX(ctx, "b", []byte("3"), 0)
+	if !stored {
+		t.Errorf("expected %v, but received %v", true, stored)
+	}
+
+	_ = b.Delete(ctx, "a")
+	if _, found, _ := b.Get(ctx, "a"); found {
+		t.Errorf("expected the deleted value to be gone")
+	}
+}
@@ -124,7 +124,7 @@ func TestCache_Add(t *testing.T) {
 
 		count := 0
 		cacheEntities := map[string]cacheEntity{}
-		cache.caches.Range(func(key, value interface{}) bool {
+		cache.rangeEntries(func(key, value interface{}) bool {
 			count++
 
 			cacheEntities[key.(string)] = value.(cacheEntity)
@@ -261,7 +261,7 @@ func TestCache_Get(t *testing.T) {
 		}
 
 		var keys []string
-		cache.caches.Range(func(key, value interface{}) bool {
+		cache.rangeEntries(func(key, value interface{}) bool {
 			a := value.(cacheEntity)
 			e, ok := c.validKeys[key.(string)]
 			if !ok {
@@ -386,7 +386,7 @@ func TestCache_Delete(t *testing.T) {
 
 		count := 0
 		var keys []string
-		cache.caches.Range(func(key, value interface{}) bool {
+		cache.rangeEntries(func(key, value interface{}) bool {
 			count++
 
 			a := value.(cacheEntity)
@@ -775,7 +775,7 @@ func TestCache_UpdateLimit(t *testing.T) {
 
 		count := 0
 		cacheEntities := map[string]cacheEntity{}
-		cache.caches.Range(func(key, value interface{}) bool {
+		cache.rangeEntries(func(key, value interface{}) bool {
 			count++
 
 			cacheEntities[key.(string)] = value.(cacheEntity)
@@ -801,3 +801,38 @@ func TestCache_UpdateLimit(t *testing.T) {
 		}
 	}
 }
+
+type benchmarkCache interface {
+	Get(cacheKey interface{}) (interface{}, bool)
+	Add(cacheKey, cacheValue interface{})
+}
+
+func benchmarkParallel(b *testing.B, cache benchmarkCache, keySpace int) {
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := i % keySpace
+			if _, ok := cache.Get(key); !ok {
+				cache.Add(key, i)
+			}
+			i++
+		}
+	})
+}
+
+// the key space is larger than the limit so that both caches keep evicting
+func BenchmarkCache_Parallel(b *testing.B) {
+	benchmarkParallel(b, New(500, WithEvictionPolicy(LRU)), 2000)
+}
+
+func BenchmarkSharded_Parallel(b *testing.B) {
+	benchmarkParallel(b, NewSharded(16, 500, WithEvictionPolicy(LRU)), 2000)
+}
+
+func BenchmarkCache_ParallelRandom(b *testing.B) {
+	benchmarkParallel(b, New(500), 2000)
+}
+
+func BenchmarkSharded_ParallelRandom(b *testing.B) {
+	benchmarkParallel(b, NewSharded(16, 500), 2000)
+}
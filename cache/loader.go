@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// call is an in-flight load shared by all the callers of GetOrLoad for the same key.
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// failure is a loader error remembered for the negative TTL.
+type failure struct {
+	err      error
+	expireAt int64
+}
+
+// GetOrLoad returns the cached value of key, or calls loader to load and cache it.
+// Concurrent callers missing the same key share one loader call and all receive its
+// result or error. The loader runs with the context of the caller which started it,
+// the other callers only stop waiting when their own context is done, and load again
+// if the loader fails with the error of that context while theirs is alive.
+func (c *Typed[K, V]) GetOrLoad(ctx context.Context, key K, loader func(ctx context.Context) (V, error)) (V, error) {
+	for {
+		value, shared, err := c.getOrLoad(ctx, key, loader)
+		// 发起加载的调用方的 context 结束不代表其他调用方失败
+		if shared && isContextError(err) && ctx.Err() == nil {
+			continue
+		}
+		return value, err
+	}
+}
+
+// getOrLoad is GetOrLoad, shared is whether the result is of a load started by another caller.
+func (c *Typed[K, V]) getOrLoad(ctx context.Context, key K, loader func(ctx context.Context) (V, error)) (_ V, shared bool, _ error) {
+	var zero V
+
+	c.mu.Lock()
+	if value, found := c.get(key); found {
+		c.counters.hits++
+		c.unlock()
+		return value, false, nil
+	}
+	c.counters.misses++
+
+	if f, found := c.failures[key]; found {
+		if c.now().UnixNano() < f.expireAt {
+			c.unlock()
+			return zero, false, f.err
+		}
+		delete(c.failures, key)
+	}
+
+	if cl, found := c.loads[key]; found {
+		c.unlock()
+		select {
+		case <-cl.done:
+			return cl.value, true, cl.err
+		case <-ctx.Done():
+			return zero, false, ctx.Err()
+		}
+	}
+
+	cl := &call[V]{done: make(chan struct{})}
+	c.loads[key] = cl
+	c.counters.loads++
+	c.unlock()
+
+	cl.value, cl.err = c.load(ctx, loader)
+
+	c.mu.Lock()
+	delete(c.loads, key)
+	if cl.err == nil {
+		c.add(key, cl.value, c.defaultTTL)
+	} else {
+		c.counters.loadErrors++
+		// 调用方的 context 取消或超时不代表 key 加载失败，不缓存
+		if c.negativeTTL > 0 && !isContextError(cl.err) {
+			c.failures[key] = &failure{
+				err:      cl.err,
+				expireAt: c.now().Add(c.negativeTTL).UnixNano(),
+			}
+		}
+	}
+	c.unlock()
+
+	close(cl.done)
+
+	return cl.value, false, cl.err
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// load calls the loader and turns a panic into an error, so that the waiters are never left hanging.
+func (c *Typed[K, V]) load(ctx context.Context, loader func(ctx context.Context) (V, error)) (value V, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("cache loader panic: %v\n%s", e, debug.Stack())
+		}
+	}()
+
+	return loader(ctx)
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTyped_GetOrLoad(t *testing.T) {
+	cache := NewTyped[string, string](5)
+
+	var loads int64
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (string, error) {
+		atomic.AddInt64(&loads, 1)
+		<-release
+		return "value0", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 50)
+	errs := make([]error, 50)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = cache.GetOrLoad(context.TODO(), "foo", loader)
+		}(i)
+	}
+
+	// wait until the first caller has started the load
+	for atomic.LoadInt64(&loads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if e, a := int64(1), atomic.LoadInt64(&loads); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	for i := range results {
+		if errs[i] != nil {
+			t.Errorf("caller %d, unexpected error %v", i, errs[i])
+		}
+		if e, a := "value0", results[i]; e != a {
+			t.Errorf("caller %d, expected %v, but received %v", i, e, a)
+		}
+	}
+
+	if a, ok := cache.Get("foo"); !ok || a != "value0" {
+		t.Errorf("expected %v, but received %v", "value0", a)
+	}
+
+	a, err := cache.GetOrLoad(context.TODO(), "foo", func(ctx context.Context) (string, error) {
+		t.Errorf("loader must not be called for a cached key")
+		return "", nil
+	})
+	if err != nil || a != "value0" {
+		t.Errorf("expected %v, but received %v %v", "value0", a, err)
+	}
+}
+
+func TestTyped_GetOrLoadSharesError(t *testing.T) {
+	cache := NewTyped[string, string](5)
+
+	loadErr := errors.New("load failed")
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := cache.GetOrLoad(context.TODO(), "foo", func(ctx context.Context) (string, error) {
+			close(started)
+			<-release
+			return "", loadErr
+		})
+		if !errors.Is(err, loadErr) {
+			t.Errorf("expected %v, but received %v", loadErr, err)
+		}
+	}()
+
+	<-started
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := cache.GetOrLoad(context.TODO(), "foo", func(ctx context.Context) (string, error) {
+			return "value0", nil
+		})
+		// either joined the failing load or started a new one after it finished
+		if err != nil && !errors.Is(err, loadErr) {
+			t.Errorf("unexpected error %v", err)
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
+func TestTyped_GetOrLoadNegativeTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache := NewTyped[string, string](5, WithNegativeTTL(time.Second))
+	cache.now = clock.Now
+
+	loadErr := errors.New("load failed")
+	var loads int
+	loader := func(ctx context.Context) (string, error) {
+		loads++
+		if loads == 1 {
+			return "", loadErr
+		}
+		return "value0", nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetOrLoad(context.TODO(), "foo", loader); !errors.Is(err, loadErr) {
+			t.Errorf("expected %v, but received %v", loadErr, err)
+		}
+	}
+	if e, a := 1, loads; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	clock.Advance(time.Second)
+
+	a, err := cache.GetOrLoad(context.TODO(), "foo", loader)
+	if err != nil || a != "value0" {
+		t.Errorf("expected %v, but received %v %v", "value0", a, err)
+	}
+}
+
+func TestTyped_GetOrLoadNegativeTTLContextError(t *testing.T) {
+	cache := NewTyped[string, string](5, WithNegativeTTL(time.Second))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	loader := func(ctx context.Context) (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("load: %w", err)
+		}
+		return "value0", nil
+	}
+	if _, err := cache.GetOrLoad(ctx, "foo", loader); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, but received %v", context.Canceled, err)
+	}
+
+	a, err := cache.GetOrLoad(context.TODO(), "foo", loader)
+	if err != nil || a != "value0" {
+		t.Errorf("expected %v, but received %v %v", "value0", a, err)
+	}
+}
+
+func TestTyped_GetOrLoadPanic(t *testing.T) {
+	cache := NewTyped[string, string](5)
+
+	_, err := cache.GetOrLoad(context.TODO(), "foo", func(ctx context.Context) (string, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Errorf("expected the panic to be returned as an error")
+	}
+	if _, ok := cache.Get("foo"); ok {
+		t.Errorf("expected key to be missing: %q", "foo")
+	}
+}
+
+func TestTyped_GetOrLoadWaiterContext(t *testing.T) {
+	cache := NewTyped[string, string](5)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_, _ = cache.GetOrLoad(context.TODO(), "foo", func(ctx context.Context) (string, error) {
+			close(started)
+			<-release
+			return "value0", nil
+		})
+	}()
+	defer close(release)
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := cache.GetOrLoad(ctx, "foo", func(ctx context.Context) (string, error) {
+		t.Errorf("loader must not be called while another load is in flight")
+		return "", nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, but received %v", context.DeadlineExceeded, err)
+	}
+}
+
+// TestTyped_GetOrLoadLeaderCanceled loads again for a waiter whose context is alive once the
+// context of the caller which started the load is canceled.
+func TestTyped_GetOrLoadLeaderCanceled(t *testing.T) {
+	cache := NewTyped[string, string](5)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	started := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		_, err := cache.GetOrLoad(ctx, "foo", func(ctx context.Context) (string, error) {
+			close(started)
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+		errs <- err
+	}()
+	<-started
+
+	values := make(chan string, 1)
+	go func() {
+		value, err := cache.GetOrLoad(context.TODO(), "foo", func(ctx context.Context) (string, error) {
+			return "value0", nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		values <- value
+	}()
+	// the waiter is counted as a miss before it waits for the load
+	for cache.Stats().Misses < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if e, a := context.Canceled, <-errs; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := "value0", <-values; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
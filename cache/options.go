@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"github.com/hxy1991/sdk-go/codec"
+	"time"
+)
+
+type config struct {
+	evictionPolicy  EvictionPolicy
+	defaultTTL      time.Duration
+	cleanupInterval time.Duration
+	negativeTTL     time.Duration
+	// onEvict and onAdd hold the typed hooks, they are checked against the types of the cache by NewTyped
+	onEvict interface{}
+	onAdd   interface{}
+	weigher interface{}
+
+	snapshotCodec codec.Codec
+
+	refreshInterval    time.Duration
+	refresher          interface{}
+	refreshConcurrency int
+	onRefreshError     interface{}
+}
+
+func newConfig(opts ...Option) *config {
+	cfg := &config{
+		evictionPolicy:     Random,
+		snapshotCodec:      codec.JSON,
+		refreshConcurrency: defaultRefreshConcurrency,
+	}
+	for _, opt := range opts {
+		opt.apply(cfg)
+	}
+	if cfg.refreshConcurrency <= 0 {
+		cfg.refreshConcurrency = defaultRefreshConcurrency
+	}
+	return cfg
+}
+
+type Option interface {
+	apply(*config)
+}
+
+type optionFunc func(*config)
+
+func (f optionFunc) apply(cfg *config) {
+	f(cfg)
+}
+
+// WithEvictionPolicy chooses which entry is removed once the cache limit is exceeded, the default is Random.
+func WithEvictionPolicy(evictionPolicy EvictionPolicy) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.evictionPolicy = evictionPolicy
+	})
+}
+
+// WithDefaultTTL sets the TTL of the entries added by Add, zero means the entries never expire.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.defaultTTL = ttl
+	})
+}
+
+// WithCleanupInterval starts a janitor which removes the expired entries every interval,
+// without it the expired entries are only removed when they are read.
+func WithCleanupInterval(interval time.Duration) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.cleanupInterval = interval
+	})
+}
+
+// WithNegativeTTL makes GetOrLoad remember a loader error for ttl, so that a failing key
+// does not call the loader again until then, except a context error of the caller which started the load.
+// Zero, the default, disables negative caching.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.negativeTTL = ttl
+	})
+}
+
+// WithOnEvict registers a hook called after an entry is removed from the cache, the types of
+// key and value must match the cache, for Cache they are both interface{}.
+// The hook is called without the lock of the cache held, so it may use the cache.
+func WithOnEvict[K comparable, V any](onEvict func(key K, value V, reason EvictionReason)) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.onEvict = onEvict
+	})
+}
+
+// WithOnAdd registers a hook called after an entry is added or replaced, see WithOnEvict.
+func WithOnAdd[K comparable, V any](onAdd func(key K, value V)) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.onAdd = onAdd
+	})
+}
+
+// WithWeigher turns the cache limit into a budget of total weight instead of a number of entries,
+// weigher returns the weight of an entry, for example the size of the value in bytes.
+// Like the number of entries, an entry is never evicted by the Add which has just added it.
+func WithWeigher[K comparable, V any](weigher func(key K, value V) int64) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.weigher = weigher
+	})
+}
+
+// WithSnapshotCodec sets how SaveSnapshot and LoadSnapshot encode the values, the keys are always
+// JSON. The default is codec.JSON, note that it decodes an interface{} value of Cache into a map.
+func WithSnapshotCodec(snapshotCodec codec.Codec) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.snapshotCodec = snapshotCodec
+	})
+}
+
+// WithRefresh makes every entry refreshed by refresher once interval has passed since it was
+// written. A read of an entry due for refresh returns the current value right away and refreshes
+// it in the background, the entries which are not read are refreshed by a periodic sweep.
+// On success the value is replaced as by Add, see ErrDeleteEntry to remove the entry instead,
+// and on error the current value is kept and the refresh is retried after interval.
+// Use a TTL longer than interval to bound how stale a value may get when refreshes keep failing.
+func WithRefresh[K comparable, V any](interval time.Duration, refresher func(ctx context.Context, key K, old V) (V, error)) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.refreshInterval = interval
+		cfg.refresher = refresher
+	})
+}
+
+// WithRefreshConcurrency bounds the number of concurrent background refreshes, the default is 16,
+// a sharded cache applies it to every shard.
+// A read never waits for it, the refresh is left to the next read or sweep instead.
+func WithRefreshConcurrency(concurrency int) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.refreshConcurrency = concurrency
+	})
+}
+
+// WithOnRefreshError registers a hook called when a background refresh fails,
+// by default the error is logged.
+func WithOnRefreshError[K comparable](onRefreshError func(key K, err error)) Option {
+	return optionFunc(func(cfg *config) {
+		cfg.onRefreshError = onRefreshError
+	})
+}
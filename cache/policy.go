@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"math/rand"
+)
+
+type EvictionPolicy int
+
+const (
+	// Random evicts an arbitrary entry, it is the original behaviour of Cache
+	Random EvictionPolicy = iota
+	// LRU evicts the least recently used entry
+	LRU
+	// LFU evicts the least frequently used entry, ties are broken by recency
+	LFU
+	// FIFO evicts the oldest added entry
+	FIFO
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case Random:
+		return "random"
+	case LRU:
+		return "lru"
+	case LFU:
+		return "lfu"
+	case FIFO:
+		return "fifo"
+	default:
+		return fmt.Sprintf("EvictionPolicy(%d)", int(p))
+	}
+}
+
+// policy keeps the bookkeeping needed to choose a victim, every method must be O(1)
+// and is always called with the lock of the cache held.
+type policy[K comparable, V any] interface {
+	add(e *entry[K, V])
+	access(e *entry[K, V])
+	remove(e *entry[K, V])
+	// victim returns the entry to be evicted next, skipping exclude, or nil if there is none
+	victim(exclude *entry[K, V]) *entry[K, V]
+}
+
+func newPolicy[K comparable, V any](p EvictionPolicy) policy[K, V] {
+	switch p {
+	case LRU:
+		return &listPolicy[K, V]{entries: list.New(), moveOnAccess: true}
+	case LFU:
+		return &lfuPolicy[K, V]{buckets: list.New()}
+	case FIFO:
+		return &listPolicy[K, V]{entries: list.New()}
+	default:
+		return &randomPolicy[K, V]{}
+	}
+}
+
+// listPolicy is used by both LRU and FIFO, the front of the list is the next victim.
+type listPolicy[K comparable, V any] struct {
+	entries      *list.List
+	moveOnAccess bool
+}
+
+func (p *listPolicy[K, V]) add(e *entry[K, V]) {
+	e.element = p.entries.PushBack(e)
+}
+
+func (p *listPolicy[K, V]) access(e *entry[K, V]) {
+	if p.moveOnAccess {
+		p.entries.MoveToBack(e.element)
+	}
+}
+
+func (p *listPolicy[K, V]) remove(e *entry[K, V]) {
+	p.entries.Remove(e.element)
+	e.element = nil
+}
+
+func (p *listPolicy[K, V]) victim(exclude *entry[K, V]) *entry[K, V] {
+	for element := p.entries.Front(); element != nil; element = element.Next() {
+		e := element.Value.(*entry[K, V])
+		if e != exclude {
+			return e
+		}
+	}
+	return nil
+}
+
+type lfuBucket struct {
+	frequency int64
+	entries   *list.List
+}
+
+// lfuPolicy keeps buckets of entries ordered by ascending frequency, so both
+// incrementing a frequency and finding the least frequently used entry are O(1).
+type lfuPolicy[K comparable, V any] struct {
+	buckets *list.List
+}
+
+func (p *lfuPolicy[K, V]) add(e *entry[K, V]) {
+	front := p.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).frequency != 1 {
+		front = p.buckets.PushFront(&lfuBucket{frequency: 1, entries: list.New()})
+	}
+	p.push(e, front)
+}
+
+func (p *lfuPolicy[K, V]) access(e *entry[K, V]) {
+	current := e.bucket
+	bucket := current.Value.(*lfuBucket)
+
+	next := current.Next()
+	if next == nil || next.Value.(*lfuBucket).frequency != bucket.frequency+1 {
+		next = p.buckets.InsertAfter(&lfuBucket{frequency: bucket.frequency + 1, entries: list.New()}, current)
+	}
+
+	p.remove(e)
+	p.push(e, next)
+}
+
+func (p *lfuPolicy[K, V]) push(e *entry[K, V], bucket *list.Element) {
+	e.bucket = bucket
+	e.element = bucket.Value.(*lfuBucket).entries.PushBack(e)
+}
+
+func (p *lfuPolicy[K, V]) remove(e *entry[K, V]) {
+	bucket := e.bucket.Value.(*lfuBucket)
+	bucket.entries.Remove(e.element)
+	if bucket.entries.Len() == 0 {
+		p.buckets.Remove(e.bucket)
+	}
+	e.bucket = nil
+	e.element = nil
+}
+
+func (p *lfuPolicy[K, V]) victim(exclude *entry[K, V]) *entry[K, V] {
+	for bucket := p.buckets.Front(); bucket != nil; bucket = bucket.Next() {
+		for element := bucket.Value.(*lfuBucket).entries.Front(); element != nil; element = element.Next() {
+			e := element.Value.(*entry[K, V])
+			if e != exclude {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// randomPolicy keeps the entries in a slice so that a random one can be picked in O(1).
+type randomPolicy[K comparable, V any] struct {
+	entries []*entry[K, V]
+}
+
+func (p *randomPolicy[K, V]) add(e *entry[K, V]) {
+	e.index = len(p.entries)
+	p.entries = append(p.entries, e)
+}
+
+func (p *randomPolicy[K, V]) access(*entry[K, V]) {}
+
+func (p *randomPolicy[K, V]) remove(e *entry[K, V]) {
+	last := len(p.entries) - 1
+	p.entries[e.index] = p.entries[last]
+	p.entries[e.index].index = e.index
+	p.entries[last] = nil
+	p.entries = p.entries[:last]
+}
+
+func (p *randomPolicy[K, V]) victim(exclude *entry[K, V]) *entry[K, V] {
+	n := len(p.entries)
+	if n == 0 || (n == 1 && p.entries[0] == exclude) {
+		return nil
+	}
+	i := rand.Intn(n)
+	if p.entries[i] == exclude {
+		i = (i + 1) % n
+	}
+	return p.entries[i]
+}
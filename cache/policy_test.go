@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestCache_EvictionPolicy(t *testing.T) {
+	cases := []struct {
+		policy       EvictionPolicy
+		limit        int64
+		adds         []string
+		gets         []string
+		lateAdds     []string
+		expectedKeys []string
+	}{
+		{
+			policy:       LRU,
+			limit:        3,
+			adds:         []string{"foo", "bar", "baz"},
+			gets:         []string{"foo"},
+			lateAdds:     []string{"qux"},
+			expectedKeys: []string{"baz", "foo", "qux"},
+		},
+		{
+			policy:       LRU,
+			limit:        2,
+			adds:         []string{"foo", "bar"},
+			gets:         []string{"foo", "bar", "foo"},
+			lateAdds:     []string{"baz", "qux"},
+			expectedKeys: []string{"baz", "qux"},
+		},
+		{
+			policy:       FIFO,
+			limit:        3,
+			adds:         []string{"foo", "bar", "baz"},
+			gets:         []string{"foo"},
+			lateAdds:     []string{"qux"},
+			expectedKeys: []string{"bar", "baz", "qux"},
+		},
+		{
+			policy:       LFU,
+			limit:        3,
+			adds:         []string{"foo", "bar", "baz"},
+			gets:         []string{"foo", "foo", "baz"},
+			lateAdds:     []string{"qux"},
+			expectedKeys: []string{"baz", "foo", "qux"},
+		},
+		{
+			policy:       LFU,
+			limit:        2,
+			adds:         []string{"foo", "bar"},
+			gets:         []string{"bar", "foo"},
+			lateAdds:     []string{"baz"},
+			expectedKeys: []string{"baz", "foo"},
+		},
+	}
+
+	for i, c := range cases {
+		cache := New(c.limit, WithEvictionPolicy(c.policy))
+
+		for _, key := range c.adds {
+			cache.Add(key, key)
+		}
+		for _, key := range c.gets {
+			cache.Get(key)
+		}
+		for _, key := range c.lateAdds {
+			cache.Add(key, key)
+		}
+
+		var keys []string
+		for _, key := range cache.Keys() {
+			keys = append(keys, key.(string))
+		}
+		sort.Strings(keys)
+
+		if e, a := fmt.Sprint(c.expectedKeys), fmt.Sprint(keys); e != a {
+			t.Errorf("case %d %s, expected %v, but received %v", i, c.policy, e, a)
+		}
+	}
+}
+
+func TestCache_EvictionPolicyConcurrent(t *testing.T) {
+	for _, policy := range []EvictionPolicy{Random, LRU, LFU, FIFO} {
+		cache := New(50, WithEvictionPolicy(policy))
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					key := (g*1000 + i) % 200
+					cache.Add(key, i)
+					cache.Get(key / 2)
+					if i%10 == 0 {
+						cache.Delete(key + 1)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		count := 0
+		cache.rangeEntries(func(key, value interface{}) bool {
+			count++
+			return true
+		})
+
+		if e, a := int64(count), cache.size; e != a {
+			t.Errorf("%s, expected %v, but received %v", policy, e, a)
+		}
+		if cache.size > cache.CacheLimit() {
+			t.Errorf("%s, size %v exceeds the limit %v", policy, cache.size, cache.CacheLimit())
+		}
+	}
+}
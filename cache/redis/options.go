@@ -0,0 +1,58 @@
+package redis
+
+import "time"
+
+type Option interface {
+	apply(*Client)
+}
+
+type optionFunc func(*Client)
+
+func (f optionFunc) apply(c *Client) {
+	f(c)
+}
+
+func WithPassword(password string) Option {
+	return optionFunc(func(c *Client) {
+		c.password = password
+	})
+}
+
+func WithDB(db int) Option {
+	return optionFunc(func(c *Client) {
+		c.db = db
+	})
+}
+
+// WithKeyPrefix is prepended to every key, so that several caches can share one Redis.
+func WithKeyPrefix(keyPrefix string) Option {
+	return optionFunc(func(c *Client) {
+		c.keyPrefix = keyPrefix
+	})
+}
+
+// WithChannel sets the pub/sub channel used by Publish and Subscribe.
+func WithChannel(channel string) Option {
+	return optionFunc(func(c *Client) {
+		c.channel = channel
+	})
+}
+
+func WithDialTimeout(dialTimeout time.Duration) Option {
+	return optionFunc(func(c *Client) {
+		c.dialTimeout = dialTimeout
+	})
+}
+
+// WithTimeout bounds every command, a shorter deadline of the context wins.
+func WithTimeout(timeout time.Duration) Option {
+	return optionFunc(func(c *Client) {
+		c.timeout = timeout
+	})
+}
+
+func WithMaxIdle(maxIdle int) Option {
+	return optionFunc(func(c *Client) {
+		c.maxIdle = maxIdle
+	})
+}
@@ -0,0 +1,359 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hxy1991/sdk-go/log"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDialTimeout = time.Second * 5
+	defaultTimeout     = time.Second * 3
+	defaultMaxIdle     = 8
+	defaultChannel     = "sdk-go:cache:invalidation"
+
+	maxResubscribeBackoff = time.Second * 30
+)
+
+var ErrClosed = errors.New("redis: client is closed")
+
+// Client is a small client of the Redis protocol, it implements cache.Backend and cache.Invalidator.
+type Client struct {
+	addr        string
+	password    string
+	db          int
+	keyPrefix   string
+	channel     string
+	dialTimeout time.Duration
+	timeout     time.Duration
+	maxIdle     int
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+}
+
+func New(addr string, opts ...Option) *Client {
+	c := &Client{
+		addr:        addr,
+		channel:     defaultChannel,
+		dialTimeout: defaultDialTimeout,
+		timeout:     defaultTimeout,
+		maxIdle:     defaultMaxIdle,
+	}
+
+	for _, opt := range opts {
+		opt.apply(c)
+	}
+
+	return c
+}
+
+func (c *Client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.Do(ctx, "GET", c.keyPrefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply %T of GET", reply)
+	}
+	return data, true, nil
+}
+
+// Set stores the value, a ttl <= 0 means the value never expires.
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", c.keyPrefix + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// SetNX stores the value only if the key does not exist, and reports whether it was stored.
+func (c *Client) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []string{"SET", c.keyPrefix + key, string(value), "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.Do(ctx, "DEL", c.keyPrefix+key)
+	return err
+}
+
+// Publish sends message to the invalidation channel.
+func (c *Client) Publish(ctx context.Context, message string) error {
+	_, err := c.Do(ctx, "PUBLISH", c.channel, message)
+	return err
+}
+
+// Subscribe calls handler for every message of the invalidation channel until ctx is done.
+// It returns once the subscription is confirmed, and then resubscribes with backoff
+// whenever the connection is lost and calls onResubscribe, if not nil, once it is back.
+func (c *Client) Subscribe(ctx context.Context, handler func(message string), onResubscribe func()) error {
+	cn, err := c.subscribe(ctx)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		backoff := time.Second
+		for {
+			c.receive(ctx, cn, handler)
+			if ctx.Err() != nil {
+				return
+			}
+
+			for {
+				log.Warn("redis subscription of [", c.channel, "] is lost, resubscribe in ", backoff)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+
+				cn, err = c.subscribe(ctx)
+				if err == nil {
+					backoff = time.Second
+					if onResubscribe != nil {
+						onResubscribe()
+					}
+					break
+				}
+				log.Error("redis resubscribe of [", c.channel, "] error ", err)
+				if backoff *= 2; backoff > maxResubscribeBackoff {
+					backoff = maxResubscribeBackoff
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *Client) subscribe(ctx context.Context) (*conn, error) {
+	cn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = cn.netConn.SetDeadline(c.deadline(ctx))
+	if err := WriteCommand(cn.writer, "SUBSCRIBE", c.channel); err != nil {
+		_ = cn.netConn.Close()
+		return nil, err
+	}
+	if _, err := ReadReply(cn.reader); err != nil {
+		_ = cn.netConn.Close()
+		return nil, err
+	}
+	_ = cn.netConn.SetDeadline(time.Time{})
+
+	return cn, nil
+}
+
+func (c *Client) receive(ctx context.Context, cn *conn, handler func(message string)) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblock the read below
+			_ = cn.netConn.Close()
+		case <-stop:
+		}
+	}()
+	defer cn.netConn.Close()
+
+	for {
+		reply, err := ReadReply(cn.reader)
+		if err != nil {
+			return
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 3 {
+			continue
+		}
+		if kind, _ := values[0].([]byte); string(kind) != "message" {
+			continue
+		}
+		if message, ok := values[2].([]byte); ok {
+			handler(string(message))
+		}
+	}
+}
+
+// Key returns key with the key prefix, for the keys of the commands sent by Do.
+func (c *Client) Key(key string) string {
+	return c.keyPrefix + key
+}
+
+// Eval runs the Lua script atomically, keys are passed as they are, see Key.
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	command := append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+	return c.Do(ctx, append(command, args...)...)
+}
+
+// Do sends one command and returns its reply, an error reply is returned as Error.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	cn, pooled, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, unsent, err := c.roundTrip(ctx, cn, args)
+	if err != nil && unsent && pooled && ctx.Err() == nil {
+		// the idle connection may have been closed by the server, retry once on a new one
+		cn, err = c.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		reply, _, err = c.roundTrip(ctx, cn, args)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.put(cn)
+
+	if e, ok := reply.(Error); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// roundTrip writes the command and reads its reply, the connection is closed on error. It reports whether
+// the command was surely not run, i.e. the write failed or the connection was closed before any reply, so
+// that it can be sent again. A command is never sent again after a timeout, as it may have been run.
+func (c *Client) roundTrip(ctx context.Context, cn *conn, args []string) (interface{}, bool, error) {
+	_ = cn.netConn.SetDeadline(c.deadline(ctx))
+	err := WriteCommand(cn.writer, args...)
+	if err != nil {
+		_ = cn.netConn.Close()
+		return nil, true, err
+	}
+
+	if _, err := cn.reader.Peek(1); err != nil {
+		_ = cn.netConn.Close()
+		return nil, errors.Is(err, io.EOF), err
+	}
+	reply, err := ReadReply(cn.reader)
+	if err != nil {
+		_ = cn.netConn.Close()
+		return nil, false, err
+	}
+	return reply, false, nil
+}
+
+func (c *Client) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// get returns an idle connection, or a new one, and whether it was idle.
+func (c *Client) get(ctx context.Context) (*conn, bool, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, false, ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, true, nil
+	}
+	c.mu.Unlock()
+
+	cn, err := c.dial(ctx)
+	return cn, false, err
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || len(c.idle) >= c.maxIdle {
+		_ = cn.netConn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := net.Dialer{Timeout: c.dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{
+		netConn: netConn,
+		reader:  bufio.NewReader(netConn),
+		writer:  bufio.NewWriter(netConn),
+	}
+
+	var commands [][]string
+	if c.password != "" {
+		commands = append(commands, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	_ = netConn.SetDeadline(c.deadline(ctx))
+	for _, command := range commands {
+		err = WriteCommand(cn.writer, command...)
+		var reply interface{}
+		if err == nil {
+			reply, err = ReadReply(cn.reader)
+		}
+		if e, ok := reply.(Error); ok {
+			err = e
+		}
+		if err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+
+	return cn, nil
+}
+
+// Close closes the idle connections, subscriptions are stopped by their context.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for _, cn := range c.idle {
+		_ = cn.netConn.Close()
+	}
+	c.idle = nil
+	return nil
+}
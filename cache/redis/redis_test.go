@@ -0,0 +1,287 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/hxy1991/sdk-go/cache/redis"
+	"github.com/hxy1991/sdk-go/cache/redis/redistest"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T) *redistest.Server {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClient(t *testing.T) {
+	s := newServer(t)
+	c := redis.New(s.Addr, redis.WithKeyPrefix("test:"), redis.WithPassword("secret"), redis.WithDB(1))
+	defer c.Close()
+
+	ctx := context.TODO()
+
+	if _, found, err := c.Get(ctx, "foo"); err != nil || found {
+		t.Errorf("expected key to be missing: %q, %v", "foo", err)
+	}
+
+	if err := c.Set(ctx, "foo", []byte("value0"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if e, a := "value0", func() string { v, _ := s.Get("test:foo"); return v }(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	data, found, err := c.Get(ctx, "foo")
+	if err != nil || !found {
+		t.Fatalf("expected key to be present: %q, %v", "foo", err)
+	}
+	if e, a := "value0", string(data); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	stored, err := c.SetNX(ctx, "foo", []byte("value1"), time.Minute)
+	if err != nil || stored {
+		t.Errorf("expected SetNX of an existing key not to be stored, %v", err)
+	}
+
+	if err := c.Delete(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := c.Get(ctx, "foo"); found {
+		t.Errorf("expected key to be missing: %q", "foo")
+	}
+
+	if err := c.Set(ctx, "bar", []byte("value1"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, found, _ := c.Get(ctx, "bar"); found {
+		t.Errorf("expected key to be expired: %q", "bar")
+	}
+
+	_, err = c.Do(ctx, "NOPE")
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		t.Errorf("expected an error reply, but received %v", err)
+	}
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	s := newServer(t)
+	c := redis.New(s.Addr, redis.WithChannel("invalidation"))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	messages := make(chan string, 10)
+	resubscribed := make(chan struct{}, 10)
+	err := c.Subscribe(ctx, func(message string) {
+		messages <- message
+	}, func() {
+		resubscribed <- struct{}{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Publish(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, messages, "foo")
+
+	// the subscription comes back after the connection is lost
+	s.CloseClientConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Subscribers("invalidation") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case <-resubscribed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected onResubscribe to be called")
+	}
+
+	if err := c.Publish(ctx, "bar"); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, messages, "bar")
+}
+
+func expectMessage(t *testing.T, messages chan string, e string) {
+	t.Helper()
+	select {
+	case a := <-messages:
+		if e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected message %v", e)
+	}
+}
+
+func TestClient_SortedSet(t *testing.T) {
+	s := newServer(t)
+	c := redis.New(s.Addr, redis.WithKeyPrefix("test:"))
+	defer c.Close()
+
+	ctx := context.TODO()
+	key := c.Key("zset")
+	if e, a := "test:zset", key; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	reply, err := c.Do(ctx, "ZADD", key, "3", "c", "1", "a", "2", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := int64(3), reply; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	cases := []struct {
+		args     []string
+		expected []string
+	}{
+		{args: []string{"-inf", "+inf"}, expected: []string{"a", "b", "c"}},
+		{args: []string{"2", "3"}, expected: []string{"b", "c"}},
+		{args: []string{"-inf", "+inf", "LIMIT", "1", "1"}, expected: []string{"b"}},
+		{args: []string{"4", "+inf"}, expected: []string{}},
+	}
+	for i, tc := range cases {
+		reply, err := c.Do(ctx, append([]string{"ZRANGEBYSCORE", key}, tc.args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members := []string{}
+		for _, member := range reply.([]interface{}) {
+			members = append(members, string(member.([]byte)))
+		}
+		if e, a := tc.expected, members; !reflect.DeepEqual(e, a) {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+
+	for _, e := range []int64{1, 0} {
+		reply, err := c.Do(ctx, "ZREM", key, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := reply; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+	}
+	if reply, _ := c.Do(ctx, "ZCARD", key); reply != int64(2) {
+		t.Errorf("expected %v, but received %v", 2, reply)
+	}
+}
+
+func TestClient_Eval(t *testing.T) {
+	s := newServer(t)
+	c := redis.New(s.Addr, redis.WithKeyPrefix("test:"))
+	defer c.Close()
+
+	script := "return redis.call('ZSCORE', KEYS[1], ARGV[1])"
+	s.RegisterScript(script, func(call func(args ...string) interface{}, keys, args []string) interface{} {
+		return call("ZSCORE", keys[0], args[0])
+	})
+
+	ctx := context.TODO()
+	key := c.Key("zset")
+	_, err := c.Do(ctx, "ZADD", key, "1.5", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		member   string
+		expected interface{}
+	}{
+		{member: "a", expected: "1.5"},
+		{member: "b", expected: nil},
+	}
+	for i, tc := range cases {
+		reply, err := c.Eval(ctx, script, []string{key}, tc.member)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, ok := reply.([]byte); ok {
+			reply = string(b)
+		}
+		if e, a := tc.expected, reply; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+
+	if _, err := c.Eval(ctx, "return 1", nil); err == nil {
+		t.Errorf("expected an error for an unknown script")
+	}
+}
+
+// TestClient_Do_Retry sends a command again on a new connection only if the idle one was closed before
+// any reply, never after a timeout as the command may have been run.
+func TestClient_Do_Retry(t *testing.T) {
+	s := newServer(t)
+	c := redis.New(s.Addr)
+	defer c.Close()
+
+	ctx := context.TODO()
+	if err := c.Set(ctx, "foo", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+	s.CloseClientConnections()
+	if ok, err := c.SetNX(ctx, "bar", []byte("value"), 0); err != nil || !ok {
+		t.Errorf("expected the command to be sent again, but received %v, %v", ok, err)
+	}
+
+	// a server which stops replying after the first command
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var commands int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					if _, err := redis.ReadReply(reader); err != nil {
+						return
+					}
+					if atomic.AddInt32(&commands, 1) == 1 {
+						_, _ = conn.Write([]byte("+OK\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	c = redis.New(listener.Addr().String(), redis.WithTimeout(time.Millisecond*100))
+	defer c.Close()
+	if err := c.Set(ctx, "foo", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetNX(ctx, "foo", []byte("value"), 0); err == nil {
+		t.Errorf("expected a timeout")
+	}
+	time.Sleep(time.Millisecond * 100)
+	if e, a := int32(2), atomic.LoadInt32(&commands); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
@@ -0,0 +1,500 @@
+// Package redistest provides an in-process server speaking enough of the Redis protocol
+// to test code built on the redis package without a real Redis.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/hxy1991/sdk-go/cache/redis"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type item struct {
+	value    string
+	expireAt time.Time
+}
+
+// ScriptFunc stands in for a Lua script run by EVAL, call runs a command like redis.call does and returns
+// its reply, an error reply is returned as redis.Error. The reply of the script is an int64, a string,
+// a []byte, nil or an error.
+type ScriptFunc func(call func(args ...string) interface{}, keys, args []string) interface{}
+
+type Server struct {
+	Addr string
+
+	listener net.Listener
+
+	mu          sync.Mutex
+	items       map[string]item
+	zsets       map[string]map[string]float64
+	scripts     map[string]ScriptFunc
+	subscribers map[string]map[*client]struct{}
+	clients     map[*client]struct{}
+	closed      bool
+}
+
+type client struct {
+	conn   net.Conn
+	writer *bufio.Writer
+	// mu serializes the replies and the pushed messages
+	mu sync.Mutex
+}
+
+// NewServer starts a server on a random local port, Close must be called to stop it.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:        listener.Addr().String(),
+		listener:    listener,
+		items:       map[string]item{},
+		zsets:       map[string]map[string]float64{},
+		scripts:     map[string]ScriptFunc{},
+		subscribers: map[string]map[*client]struct{}{},
+		clients:     map[*client]struct{}{},
+	}
+	go s.serve()
+
+	return s, nil
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	clients := s.clients
+	s.clients = map[*client]struct{}{}
+	s.mu.Unlock()
+
+	_ = s.listener.Close()
+	for c := range clients {
+		_ = c.conn.Close()
+	}
+}
+
+// CloseClientConnections drops every connection, e.g. to test reconnection.
+func (s *Server) CloseClientConnections() {
+	s.mu.Lock()
+	clients := s.clients
+	s.clients = map[*client]struct{}{}
+	s.subscribers = map[string]map[*client]struct{}{}
+	s.mu.Unlock()
+
+	for c := range clients {
+		_ = c.conn.Close()
+	}
+}
+
+// Get returns the value of key as it is stored, for assertions.
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, found := s.lookup(key)
+	return it.value, found
+}
+
+// RegisterScript makes EVAL run fn for script, as the server can not run Lua.
+func (s *Server) RegisterScript(script string, fn ScriptFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts[script] = fn
+}
+
+// Subscribers returns the number of subscribers of channel.
+func (s *Server) Subscribers(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.subscribers[channel])
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &client{
+			conn:   conn,
+			writer: bufio.NewWriter(conn),
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.clients[c] = struct{}{}
+		s.mu.Unlock()
+
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c *client) {
+	defer s.disconnect(c)
+
+	reader := bufio.NewReader(c.conn)
+	for {
+		reply, err := redis.ReadReply(reader)
+		if err != nil {
+			return
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) == 0 {
+			c.write("-ERR protocol error\r\n")
+			continue
+		}
+
+		args := make([]string, len(values))
+		for i, v := range values {
+			b, _ := v.([]byte)
+			args[i] = string(b)
+		}
+		c.write(s.execute(c, args))
+	}
+}
+
+func (s *Server) disconnect(c *client) {
+	_ = c.conn.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.clients, c)
+	for _, subscribers := range s.subscribers {
+		delete(subscribers, c)
+	}
+}
+
+func (s *Server) execute(c *client, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.command(c, args)
+}
+
+// command runs one command. The lock must be held.
+func (s *Server) command(c *client, args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		if len(args) != 2 {
+			return wrongArgs(args[0])
+		}
+		it, found := s.lookup(args[1])
+		if !found {
+			return "$-1\r\n"
+		}
+		return bulk(it.value)
+	case "SET":
+		return s.set(args)
+	case "DEL":
+		if len(args) < 2 {
+			return wrongArgs(args[0])
+		}
+		count := 0
+		for _, key := range args[1:] {
+			if _, found := s.lookup(key); found {
+				delete(s.items, key)
+				count++
+			}
+			if _, found := s.zsets[key]; found {
+				delete(s.zsets, key)
+				count++
+			}
+		}
+		return integer(count)
+	case "EXISTS":
+		if len(args) < 2 {
+			return wrongArgs(args[0])
+		}
+		count := 0
+		for _, key := range args[1:] {
+			if _, found := s.lookup(key); found {
+				count++
+			}
+			if _, found := s.zsets[key]; found {
+				count++
+			}
+		}
+		return integer(count)
+	case "FLUSHALL", "FLUSHDB":
+		s.items = map[string]item{}
+		s.zsets = map[string]map[string]float64{}
+		return "+OK\r\n"
+	case "ZADD":
+		return s.zadd(args)
+	case "ZREM":
+		if len(args) < 3 {
+			return wrongArgs(args[0])
+		}
+		count := 0
+		for _, member := range args[2:] {
+			if _, found := s.zsets[args[1]][member]; found {
+				delete(s.zsets[args[1]], member)
+				count++
+			}
+		}
+		if len(s.zsets[args[1]]) == 0 {
+			delete(s.zsets, args[1])
+		}
+		return integer(count)
+	case "ZSCORE":
+		if len(args) != 3 {
+			return wrongArgs(args[0])
+		}
+		score, found := s.zsets[args[1]][args[2]]
+		if !found {
+			return "$-1\r\n"
+		}
+		return bulk(strconv.FormatFloat(score, 'f', -1, 64))
+	case "ZCARD":
+		if len(args) != 2 {
+			return wrongArgs(args[0])
+		}
+		return integer(len(s.zsets[args[1]]))
+	case "ZRANGEBYSCORE":
+		return s.zrangeByScore(args)
+	case "EVAL":
+		return s.eval(c, args)
+	case "PUBLISH":
+		if len(args) != 3 {
+			return wrongArgs(args[0])
+		}
+		message := "*3\r\n" + bulk("message") + bulk(args[1]) + bulk(args[2])
+		subscribers := s.subscribers[args[1]]
+		for subscriber := range subscribers {
+			go subscriber.write(message)
+		}
+		return integer(len(subscribers))
+	case "SUBSCRIBE":
+		if len(args) < 2 {
+			return wrongArgs(args[0])
+		}
+		var reply strings.Builder
+		for i, channel := range args[1:] {
+			if s.subscribers[channel] == nil {
+				s.subscribers[channel] = map[*client]struct{}{}
+			}
+			s.subscribers[channel][c] = struct{}{}
+			reply.WriteString("*3\r\n" + bulk("subscribe") + bulk(channel) + integer(i+1))
+		}
+		return reply.String()
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// eval supports EVAL script numkeys [key ...] [arg ...] for the registered scripts.
+func (s *Server) eval(c *client, args []string) string {
+	if len(args) < 3 {
+		return wrongArgs(args[0])
+	}
+	fn, found := s.scripts[args[1]]
+	if !found {
+		return "-ERR unknown script\r\n"
+	}
+	numKeys, err := strconv.Atoi(args[2])
+	if err != nil || numKeys < 0 || numKeys > len(args)-3 {
+		return "-ERR Number of keys can't be greater than number of args\r\n"
+	}
+
+	call := func(args ...string) interface{} {
+		reply, err := redis.ReadReply(bufio.NewReader(strings.NewReader(s.command(c, args))))
+		if err != nil {
+			return redis.Error(err.Error())
+		}
+		return reply
+	}
+	switch reply := fn(call, args[3:3+numKeys], args[3+numKeys:]).(type) {
+	case nil:
+		return "$-1\r\n"
+	case int64:
+		return integer(int(reply))
+	case string:
+		return bulk(reply)
+	case []byte:
+		return bulk(string(reply))
+	case error:
+		return "-" + reply.Error() + "\r\n"
+	default:
+		return fmt.Sprintf("-ERR unsupported script reply %T\r\n", reply)
+	}
+}
+
+// set supports SET key value [NX] [PX milliseconds | EX seconds].
+func (s *Server) set(args []string) string {
+	if len(args) < 3 {
+		return wrongArgs(args[0])
+	}
+
+	it := item{value: args[2]}
+	nx := false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "PX", "EX":
+			if i+1 >= len(args) {
+				return "-ERR syntax error\r\n"
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return "-ERR invalid expire time in 'set' command\r\n"
+			}
+			unit := time.Millisecond
+			if strings.ToUpper(args[i]) == "EX" {
+				unit = time.Second
+			}
+			it.expireAt = time.Now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			return "-ERR syntax error\r\n"
+		}
+	}
+
+	if _, found := s.lookup(args[1]); found && nx {
+		return "$-1\r\n"
+	}
+	s.items[args[1]] = it
+	return "+OK\r\n"
+}
+
+// zadd supports ZADD key [XX] score member [score member ...].
+func (s *Server) zadd(args []string) string {
+	xx := len(args) > 2 && strings.EqualFold(args[2], "XX")
+	if xx {
+		args = append(args[:2:2], args[3:]...)
+	}
+	if len(args) < 4 || len(args)%2 != 0 {
+		return wrongArgs(args[0])
+	}
+	key := args[1]
+
+	zset := s.zsets[key]
+	if zset == nil && xx {
+		return integer(0)
+	}
+	if zset == nil {
+		zset = map[string]float64{}
+		s.zsets[key] = zset
+	}
+	count := 0
+	for i := 2; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return "-ERR value is not a valid float\r\n"
+		}
+		_, found := zset[args[i+1]]
+		if !found && xx {
+			continue
+		}
+		if !found {
+			count++
+		}
+		zset[args[i+1]] = score
+	}
+	return integer(count)
+}
+
+// zrangeByScore supports ZRANGEBYSCORE key min max [LIMIT offset count], min and max may be -inf and +inf.
+func (s *Server) zrangeByScore(args []string) string {
+	if len(args) != 4 && len(args) != 7 {
+		return wrongArgs(args[0])
+	}
+	min, err1 := strconv.ParseFloat(args[2], 64)
+	max, err2 := strconv.ParseFloat(args[3], 64)
+	if err1 != nil || err2 != nil {
+		return "-ERR min or max is not a float\r\n"
+	}
+	offset, count := 0, -1
+	if len(args) == 7 {
+		if strings.ToUpper(args[4]) != "LIMIT" {
+			return "-ERR syntax error\r\n"
+		}
+		var err error
+		if offset, err = strconv.Atoi(args[5]); err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		if count, err = strconv.Atoi(args[6]); err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+	}
+
+	var members []string
+	for member, score := range s.zsets[args[1]] {
+		if score >= min && score <= max {
+			members = append(members, member)
+		}
+	}
+	zset := s.zsets[args[1]]
+	sort.Slice(members, func(i, j int) bool {
+		if zset[members[i]] != zset[members[j]] {
+			return zset[members[i]] < zset[members[j]]
+		}
+		return members[i] < members[j]
+	})
+
+	if offset > len(members) {
+		offset = len(members)
+	}
+	members = members[offset:]
+	if count >= 0 && count < len(members) {
+		members = members[:count]
+	}
+
+	var reply strings.Builder
+	reply.WriteString(fmt.Sprintf("*%d\r\n", len(members)))
+	for _, member := range members {
+		reply.WriteString(bulk(member))
+	}
+	return reply.String()
+}
+
+// lookup returns the item which has not expired. The lock must be held.
+func (s *Server) lookup(key string) (item, bool) {
+	it, found := s.items[key]
+	if !found {
+		return item{}, false
+	}
+	if !it.expireAt.IsZero() && !time.Now().Before(it.expireAt) {
+		delete(s.items, key)
+		return item{}, false
+	}
+	return it, true
+}
+
+func (c *client) write(reply string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, _ = c.writer.WriteString(reply)
+	_ = c.writer.Flush()
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func integer(n int) string {
+	return fmt.Sprintf(":%d\r\n", n)
+}
+
+func wrongArgs(command string) string {
+	return fmt.Sprintf("-ERR wrong number of arguments for '%s' command\r\n", strings.ToLower(command))
+}
@@ -0,0 +1,301 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hxy1991/sdk-go/log"
+	"github.com/hxy1991/sdk-go/ticker"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrDeleteEntry is returned by a refresher to remove the entry instead of refreshing it,
+// for example when its source no longer exists.
+var ErrDeleteEntry = errors.New("cache: delete entry")
+
+const (
+	defaultRefreshConcurrency = 16
+	// the due entries are swept refreshSweeps times per refresh interval,
+	// so that an entry which is not read is refreshed at most a quarter of the interval late
+	refreshSweeps = 4
+)
+
+// refreshTask is what a refresh needs of an entry, it is copied while the lock is held.
+type refreshTask[K comparable, V any] struct {
+	entry      *entry[K, V]
+	key        K
+	old        V
+	generation uint64
+	refresher  func(ctx context.Context, key K, old V) (V, error)
+}
+
+// AddWithRefresh adds the value with the default TTL of the cache, and refreshes it by refresher
+// every interval instead of the refresher of the cache, see WithRefresh.
+// A later Add of the same key replaces the value but keeps refreshing it by refresher.
+func (c *Typed[K, V]) AddWithRefresh(cacheKey K, cacheValue V, interval time.Duration, refresher func(ctx context.Context, key K, old V) (V, error)) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	e := c.add(cacheKey, cacheValue, c.defaultTTL)
+	if c.caches[cacheKey] != e {
+		// evicted right away, e.g. by a zero limit
+		return
+	}
+	e.refreshInterval = interval
+	e.refresher = refresher
+	c.scheduleRefresh(e)
+	c.sweepEvery(interval)
+}
+
+// Refresh refreshes the entry of key right away and waits for it, whether it is due or not.
+// It does nothing if the entry does not exist or has no refresher. Unlike a background refresh,
+// it is not bounded by the refresh concurrency and its error is returned instead of passed to the hook.
+func (c *Typed[K, V]) Refresh(ctx context.Context, key K) error {
+	c.mu.Lock()
+	e, found := c.caches[key]
+	if !found || e.expired(c.now().UnixNano()) || c.refresherOf(e) == nil {
+		c.mu.Unlock()
+		return nil
+	}
+	t := c.newRefreshTask(e)
+	c.mu.Unlock()
+
+	return c.runRefresh(ctx, t)
+}
+
+// RefreshDue refreshes all the entries due for refresh and waits for them, it is called
+// periodically when a refresh interval is set. It does nothing once the cache is closed.
+func (c *Typed[K, V]) RefreshDue() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshes.Add(1)
+	defer c.refreshes.Done()
+
+	now := c.now().UnixNano()
+	var tasks []*refreshTask[K, V]
+	for _, e := range c.caches {
+		if !e.expired(now) && c.refreshDue(e, now) {
+			tasks = append(tasks, c.newRefreshTask(e))
+		}
+	}
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		// unlike a read, the sweep waits for its turn
+		c.refreshTokens <- struct{}{}
+		wg.Add(1)
+		go func(t *refreshTask[K, V]) {
+			defer func() {
+				<-c.refreshTokens
+				wg.Done()
+			}()
+			c.refreshInBackground(t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// UpdateRefreshInterval changes the refresh interval of the entries which were not added by
+// AddWithRefresh, and returns the old one. The entries keep the time they were last refreshed,
+// so an entry is due right away if that is longer ago than the new interval.
+// A refresh interval <= 0 stops refreshing them.
+func (c *Typed[K, V]) UpdateRefreshInterval(interval time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	oldInterval := c.refreshInterval
+	c.refreshInterval = interval
+
+	now := c.now().UnixNano()
+	// the sweep follows the shortest interval in use
+	var minInterval time.Duration
+	if c.refresher != nil {
+		minInterval = interval
+	}
+	for _, e := range c.caches {
+		if e.refresher != nil {
+			if e.refreshInterval > 0 && (minInterval <= 0 || e.refreshInterval < minInterval) {
+				minInterval = e.refreshInterval
+			}
+			continue
+		}
+		switch {
+		case interval <= 0:
+			e.refreshAt = 0
+		case e.refreshAt > 0:
+			e.refreshAt += int64(interval - oldInterval)
+		default:
+			e.refreshAt = now + int64(interval)
+		}
+	}
+
+	if c.sweeper != nil && minInterval/refreshSweeps > 0 {
+		c.sweeper.Reset(minInterval / refreshSweeps)
+	} else {
+		c.sweepEvery(minInterval)
+	}
+
+	return oldInterval
+}
+
+func (c *Typed[K, V]) RefreshInterval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refreshInterval
+}
+
+// refresherOf returns the refresher of the entry, or nil if it is not refreshed. The lock must be held.
+func (c *Typed[K, V]) refresherOf(e *entry[K, V]) func(ctx context.Context, key K, old V) (V, error) {
+	if e.refresher != nil {
+		return e.refresher
+	}
+	if c.refreshInterval <= 0 {
+		return nil
+	}
+	return c.refresher
+}
+
+// scheduleRefresh sets when the entry is due for refresh from now. The lock must be held.
+func (c *Typed[K, V]) scheduleRefresh(e *entry[K, V]) {
+	interval := c.refreshInterval
+	if e.refresher != nil {
+		interval = e.refreshInterval
+	}
+	if interval <= 0 || c.refresherOf(e) == nil {
+		e.refreshAt = 0
+		return
+	}
+	e.refreshAt = c.now().Add(interval).UnixNano()
+}
+
+// refreshDue reports whether the entry should be refreshed and is not being refreshed. The lock must be held.
+func (c *Typed[K, V]) refreshDue(e *entry[K, V], now int64) bool {
+	return e.refreshAt > 0 && now >= e.refreshAt && !e.refreshing && c.refresherOf(e) != nil
+}
+
+// sweepEvery makes the due entries swept at least refreshSweeps times per interval. The lock must be held.
+func (c *Typed[K, V]) sweepEvery(interval time.Duration) {
+	period := interval / refreshSweeps
+	if period <= 0 || c.closed {
+		return
+	}
+	if c.sweeper == nil {
+		c.sweeper = ticker.New(period, c.RefreshDue)
+		c.sweeper.Start()
+		return
+	}
+	if period < c.sweeper.Interval() {
+		c.sweeper.Reset(period)
+	}
+}
+
+// newRefreshTask marks the entry as being refreshed. The lock must be held.
+func (c *Typed[K, V]) newRefreshTask(e *entry[K, V]) *refreshTask[K, V] {
+	e.refreshing = true
+	return &refreshTask[K, V]{
+		entry:      e,
+		key:        e.key,
+		old:        e.value,
+		generation: e.generation,
+		refresher:  c.refresherOf(e),
+	}
+}
+
+// refreshAsync starts a background refresh of the entry if the refresh concurrency allows it,
+// otherwise the refresh is left to the next read or sweep. The lock must be held.
+func (c *Typed[K, V]) refreshAsync(e *entry[K, V]) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.refreshTokens <- struct{}{}:
+	default:
+		return
+	}
+
+	t := c.newRefreshTask(e)
+	c.refreshes.Add(1)
+	go func() {
+		defer func() {
+			<-c.refreshTokens
+			c.refreshes.Done()
+		}()
+		c.refreshInBackground(t)
+	}()
+}
+
+// refreshInBackground runs a refresh with the context of the background refreshes, its error is
+// not reported once Close canceled it.
+func (c *Typed[K, V]) refreshInBackground(t *refreshTask[K, V]) {
+	err := c.runRefresh(c.refreshCtx, t)
+	if c.refreshCtx.Err() == nil {
+		c.notifyRefreshError(t.key, err)
+	}
+}
+
+// runRefresh calls the refresher and applies its result to the entry, unless the entry was
+// removed or written meanwhile.
+func (c *Typed[K, V]) runRefresh(ctx context.Context, t *refreshTask[K, V]) error {
+	value, err := callRefresher(ctx, t)
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	e := t.entry
+	e.refreshing = false
+	if c.caches[t.key] != e || e.generation != t.generation {
+		return nil
+	}
+	if c.closed && ctx.Err() != nil {
+		// canceled by Close, the result is discarded
+		return nil
+	}
+
+	c.counters.refreshes++
+	if errors.Is(err, ErrDeleteEntry) {
+		c.remove(e, ReasonDeleted)
+		return nil
+	}
+	if err != nil {
+		c.counters.refreshErrors++
+		// 保留旧值，下个周期重试
+		c.scheduleRefresh(e)
+		return err
+	}
+
+	expireAt := e.expireAt
+	if e.ttl > 0 {
+		expireAt = c.now().Add(e.ttl).UnixNano()
+	}
+	c.addExpireAt(t.key, value, expireAt)
+	return nil
+}
+
+// callRefresher turns a panic of the refresher into an error.
+func callRefresher[K comparable, V any](ctx context.Context, t *refreshTask[K, V]) (value V, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("cache refresher panic: %v\n%s", e, debug.Stack())
+		}
+	}()
+
+	return t.refresher(ctx, t.key, t.old)
+}
+
+func (c *Typed[K, V]) notifyRefreshError(key K, err error) {
+	if err == nil {
+		return
+	}
+	if c.onRefreshError != nil {
+		c.onRefreshError(key, err)
+		return
+	}
+	log.Error("refresh cache [", key, "] error ", err)
+}
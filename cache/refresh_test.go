@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTyped_RefreshDue(t *testing.T) {
+	cases := []struct {
+		refresher             func(ctx context.Context, key string, old string) (string, error)
+		expectedValue         string
+		expectedFound         bool
+		expectedRefreshErrors int64
+		expectedError         string
+	}{
+		{
+			refresher: func(ctx context.Context, key string, old string) (string, error) {
+				return old + "1", nil
+			},
+			expectedValue: "value01",
+			expectedFound: true,
+		},
+		{
+			refresher: func(ctx context.Context, key string, old string) (string, error) {
+				return "", errors.New("refresh failed")
+			},
+			expectedValue:         "value0",
+			expectedFound:         true,
+			expectedRefreshErrors: 1,
+			expectedError:         "refresh failed",
+		},
+		{
+			refresher: func(ctx context.Context, key string, old string) (string, error) {
+				panic("boom")
+			},
+			expectedValue:         "value0",
+			expectedFound:         true,
+			expectedRefreshErrors: 1,
+			expectedError:         "cache refresher panic: boom",
+		},
+		{
+			refresher: func(ctx context.Context, key string, old string) (string, error) {
+				return "", ErrDeleteEntry
+			},
+			expectedFound: false,
+		},
+	}
+
+	for i, c := range cases {
+		clock := &fakeClock{now: time.Unix(0, 0)}
+		var refreshes int64
+		var refreshErr error
+		cache := NewTyped[string, string](10,
+			WithRefresh(time.Hour, func(ctx context.Context, key string, old string) (string, error) {
+				atomic.AddInt64(&refreshes, 1)
+				return c.refresher(ctx, key, old)
+			}),
+			WithOnRefreshError(func(key string, err error) {
+				refreshErr = err
+			}),
+		)
+		cache.now = clock.Now
+
+		cache.Add("foo", "value0")
+		cache.RefreshDue()
+		if e, a := int64(0), atomic.LoadInt64(&refreshes); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+
+		clock.Advance(time.Hour)
+		cache.RefreshDue()
+		if e, a := int64(1), atomic.LoadInt64(&refreshes); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+
+		// Peek through rangeEntries, a Get would trigger another refresh on error
+		var value string
+		var found bool
+		cache.rangeEntries(func(key string, v string) bool {
+			value, found = v, key == "foo"
+			return true
+		})
+		if e, a := c.expectedFound, found; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		if e, a := c.expectedValue, value; found && e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+
+		stats := cache.Stats()
+		if e, a := int64(1), stats.Refreshes; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		if e, a := c.expectedRefreshErrors, stats.RefreshErrors; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		if c.expectedError == "" && refreshErr != nil {
+			t.Errorf("case %d, unexpected error %v", i, refreshErr)
+		}
+		if c.expectedError != "" && (refreshErr == nil || !strings.HasPrefix(refreshErr.Error(), c.expectedError)) {
+			t.Errorf("case %d, expected %v, but received %v", i, c.expectedError, refreshErr)
+		}
+
+		// the next refresh, failed or not, is only due after the interval
+		cache.RefreshDue()
+		if e, a := int64(1), atomic.LoadInt64(&refreshes); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		cache.Close()
+	}
+}
+
+func TestTyped_RefreshStaleWhileRevalidate(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var refreshes int64
+	release := make(chan struct{})
+	cache := NewTyped[string, string](10,
+		WithRefresh(time.Hour, func(ctx context.Context, key string, old string) (string, error) {
+			atomic.AddInt64(&refreshes, 1)
+			<-release
+			return "value1", nil
+		}),
+		WithRefreshConcurrency(1),
+	)
+	defer cache.Close()
+	cache.now = clock.Now
+
+	cache.Add("foo", "value0")
+	cache.Add("bar", "value0")
+	clock.Advance(time.Hour)
+
+	// the stale values are returned while foo is refreshed, bar waits for a free slot
+	for _, key := range []string{"foo", "foo", "bar"} {
+		if a, ok := cache.Get(key); !ok || a != "value0" {
+			t.Errorf("expected %v, but received %v", "value0", a)
+		}
+	}
+	for atomic.LoadInt64(&refreshes) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if a, _ := cache.Get("foo"); a == "value1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v to be refreshed", "foo")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if e, a := int64(1), atomic.LoadInt64(&refreshes); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	// the refreshed entry is due again after the interval
+	cache.RefreshDue()
+	if e, a := int64(2), atomic.LoadInt64(&refreshes); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if a, _ := cache.Get("bar"); a != "value1" {
+		t.Errorf("expected %v, but received %v", "value1", a)
+	}
+}
+
+func TestTyped_RefreshDiscardedAfterWrite(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cache := NewTyped[string, string](10,
+		WithRefresh(time.Hour, func(ctx context.Context, key string, old string) (string, error) {
+			close(started)
+			<-release
+			return "refreshed", nil
+		}),
+	)
+	defer cache.Close()
+	cache.now = clock.Now
+
+	cache.Add("foo", "value0")
+	clock.Advance(time.Hour)
+
+	done := make(chan error)
+	go func() {
+		done <- cache.Refresh(context.TODO(), "foo")
+	}()
+	<-started
+	cache.Add("foo", "value1")
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if a, _ := cache.Get("foo"); a != "value1" {
+		t.Errorf("expected %v, but received %v", "value1", a)
+	}
+	if e, a := int64(0), cache.Stats().Refreshes; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestTyped_AddWithRefresh(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache := NewTyped[string, int](10, WithDefaultTTL(time.Hour))
+	defer cache.Close()
+	cache.now = clock.Now
+
+	cache.AddWithRefresh("foo", 0, time.Minute, func(ctx context.Context, key string, old int) (int, error) {
+		return old + 1, nil
+	})
+	cache.Add("bar", 0)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Minute)
+		cache.RefreshDue()
+	}
+	// a refresh resets the TTL
+	clock.Advance(time.Hour - time.Minute)
+
+	if a, _ := cache.Get("foo"); a != 3 {
+		t.Errorf("expected %v, but received %v", 3, a)
+	}
+	if _, found := cache.Get("bar"); found {
+		t.Errorf("expected %v to be expired", "bar")
+	}
+
+	// Add keeps the refresher of the entry
+	cache.Add("foo", 10)
+	clock.Advance(time.Minute)
+	if err := cache.Refresh(context.TODO(), "foo"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if a, _ := cache.Get("foo"); a != 11 {
+		t.Errorf("expected %v, but received %v", 11, a)
+	}
+}
+
+func TestTyped_UpdateRefreshInterval(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var refreshes int64
+	cache := NewTyped[string, string](10, WithRefresh(time.Hour, func(ctx context.Context, key string, old string) (string, error) {
+		atomic.AddInt64(&refreshes, 1)
+		return old, nil
+	}))
+	defer cache.Close()
+	cache.now = clock.Now
+
+	cache.Add("foo", "value0")
+	clock.Advance(time.Minute * 30)
+
+	if e, a := time.Hour, cache.UpdateRefreshInterval(time.Minute*20); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := time.Minute*20, cache.RefreshInterval(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	// foo was added 30 minutes ago, so it is due right away with the new interval
+	cache.RefreshDue()
+	if e, a := int64(1), atomic.LoadInt64(&refreshes); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	cache.UpdateRefreshInterval(0)
+	clock.Advance(time.Hour)
+	cache.RefreshDue()
+	if e, a := int64(1), atomic.LoadInt64(&refreshes); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+// TestTyped_CloseRefreshes cancels the in-flight background refreshes and waits for them.
+func TestTyped_CloseRefreshes(t *testing.T) {
+	started := make(chan struct{})
+	var finished int32
+	cache := NewTyped[string, string](5, WithRefresh[string, string](time.Millisecond*20,
+		func(ctx context.Context, key string, old string) (string, error) {
+			close(started)
+			<-ctx.Done()
+			atomic.StoreInt32(&finished, 1)
+			return "", ctx.Err()
+		}))
+	cache.Add("foo", "value0")
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected the background refresh to start")
+	}
+	cache.Close()
+
+	if e, a := int32(1), atomic.LoadInt32(&finished); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := int64(0), cache.Stats().RefreshErrors; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
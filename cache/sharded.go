@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"hash/maphash"
+	"sync/atomic"
+	"time"
+)
+
+// ShardedTyped spreads the entries over independent Typed shards by the hash of the key,
+// so that goroutines working on different keys rarely wait on the same lock. Each shard
+// has its own part of the limit and evicts on its own, so the eviction policy is only
+// applied per shard.
+type ShardedTyped[K comparable, V any] struct {
+	shards []*Typed[K, V]
+	seed   maphash.Seed
+	// active is the number of the shards the keys are routed to, the others have a zero limit
+	active int64
+}
+
+// Sharded is the untyped ShardedTyped, it has the same API as Cache.
+type Sharded struct {
+	*ShardedTyped[interface{}, interface{}]
+}
+
+// NewSharded creates a cache of shardCount shards sharing cacheLimit evenly.
+func NewSharded(shardCount int, cacheLimit int64, opts ...Option) *Sharded {
+	return &Sharded{
+		ShardedTyped: NewShardedTyped[interface{}, interface{}](shardCount, cacheLimit, opts...),
+	}
+}
+
+func NewShardedTyped[K comparable, V any](shardCount int, cacheLimit int64, opts ...Option) *ShardedTyped[K, V] {
+	if shardCount < 1 {
+		shardCount = 1
+	}
+
+	c := &ShardedTyped[K, V]{
+		shards: make([]*Typed[K, V], shardCount),
+		seed:   maphash.MakeSeed(),
+		active: activeShards(cacheLimit, shardCount),
+	}
+	for i := range c.shards {
+		c.shards[i] = NewTyped[K, V](shardLimit(cacheLimit, shardCount, i), opts...)
+	}
+	return c
+}
+
+// shardLimit splits cacheLimit so that the limits of all the shards add up to it.
+func shardLimit(cacheLimit int64, shardCount int, i int) int64 {
+	limit := cacheLimit / int64(shardCount)
+	if int64(i) < cacheLimit%int64(shardCount) {
+		limit++
+	}
+	return limit
+}
+
+// activeShards is the number of the shards with a non-zero limit, a shard of a zero limit would still
+// keep the entry just added to it.
+func activeShards(cacheLimit int64, shardCount int) int64 {
+	if cacheLimit > 0 && cacheLimit < int64(shardCount) {
+		return cacheLimit
+	}
+	return int64(shardCount)
+}
+
+func (c *ShardedTyped[K, V]) shard(key K) *Typed[K, V] {
+	return c.shards[c.index(key, atomic.LoadInt64(&c.active))]
+}
+
+func (c *ShardedTyped[K, V]) index(key K, active int64) int {
+	if active == 1 {
+		return 0
+	}
+	return int(c.hash(key) % uint64(active))
+}
+
+func (c *ShardedTyped[K, V]) hash(key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return maphash.String(c.seed, k)
+	case int:
+		return mix(uint64(k))
+	case int32:
+		return mix(uint64(k))
+	case int64:
+		return mix(uint64(k))
+	case uint:
+		return mix(uint64(k))
+	case uint32:
+		return mix(uint64(k))
+	case uint64:
+		return mix(k)
+	default:
+		return maphash.String(c.seed, fmt.Sprintf("%T:%v", k, k))
+	}
+}
+
+// mix is the finalizer of splitmix64, it spreads sequential integers over all the shards.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (c *ShardedTyped[K, V]) Get(cacheKey K) (V, bool) {
+	return c.shard(cacheKey).Get(cacheKey)
+}
+
+func (c *ShardedTyped[K, V]) Add(cacheKey K, cacheValue V) {
+	c.shard(cacheKey).Add(cacheKey, cacheValue)
+}
+
+func (c *ShardedTyped[K, V]) AddWithTTL(cacheKey K, cacheValue V, ttl time.Duration) {
+	c.shard(cacheKey).AddWithTTL(cacheKey, cacheValue, ttl)
+}
+
+func (c *ShardedTyped[K, V]) GetOrLoad(ctx context.Context, key K, loader func(ctx context.Context) (V, error)) (V, error) {
+	return c.shard(key).GetOrLoad(ctx, key, loader)
+}
+
+func (c *ShardedTyped[K, V]) Delete(key K) {
+	c.shard(key).Delete(key)
+}
+
+func (c *ShardedTyped[K, V]) AddWithRefresh(cacheKey K, cacheValue V, interval time.Duration, refresher func(ctx context.Context, key K, old V) (V, error)) {
+	c.shard(cacheKey).AddWithRefresh(cacheKey, cacheValue, interval, refresher)
+}
+
+func (c *ShardedTyped[K, V]) Refresh(ctx context.Context, key K) error {
+	return c.shard(key).Refresh(ctx, key)
+}
+
+func (c *ShardedTyped[K, V]) RefreshDue() {
+	for _, shard := range c.shards {
+		shard.RefreshDue()
+	}
+}
+
+func (c *ShardedTyped[K, V]) UpdateRefreshInterval(interval time.Duration) time.Duration {
+	var oldInterval time.Duration
+	for _, shard := range c.shards {
+		oldInterval = shard.UpdateRefreshInterval(interval)
+	}
+	return oldInterval
+}
+
+func (c *ShardedTyped[K, V]) RefreshInterval() time.Duration {
+	return c.shards[0].RefreshInterval()
+}
+
+func (c *ShardedTyped[K, V]) DeleteExpired() {
+	for _, shard := range c.shards {
+		shard.DeleteExpired()
+	}
+}
+
+func (c *ShardedTyped[K, V]) Keys() []K {
+	var keys []K
+	for _, shard := range c.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+// UpdateCacheLimit splits the new limit over the shards and returns the old total limit. If the number
+// of the shards the keys are routed to changes, the entries which are in another shard are removed.
+func (c *ShardedTyped[K, V]) UpdateCacheLimit(cacheLimit int64) int64 {
+	var oldCacheLimit int64
+	for i, shard := range c.shards {
+		oldCacheLimit += shard.UpdateCacheLimit(shardLimit(cacheLimit, len(c.shards), i))
+	}
+
+	active := activeShards(cacheLimit, len(c.shards))
+	if atomic.SwapInt64(&c.active, active) != active {
+		for i, shard := range c.shards {
+			for _, key := range shard.Keys() {
+				if c.index(key, active) != i {
+					shard.Delete(key)
+				}
+			}
+		}
+	}
+	return oldCacheLimit
+}
+
+func (c *ShardedTyped[K, V]) CacheLimit() int64 {
+	var cacheLimit int64
+	for _, shard := range c.shards {
+		cacheLimit += shard.CacheLimit()
+	}
+	return cacheLimit
+}
+
+func (c *ShardedTyped[K, V]) Weight() int64 {
+	var weight int64
+	for _, shard := range c.shards {
+		weight += shard.Weight()
+	}
+	return weight
+}
+
+func (c *ShardedTyped[K, V]) EvictionPolicy() EvictionPolicy {
+	return c.shards[0].EvictionPolicy()
+}
+
+// Stats adds up the stats of all the shards.
+func (c *ShardedTyped[K, V]) Stats() Stats {
+	stats := Stats{
+		Evictions: map[EvictionReason]int64{},
+	}
+	for _, shard := range c.shards {
+		s := shard.Stats()
+		stats.Hits += s.Hits
+		stats.Misses += s.Misses
+		stats.Loads += s.Loads
+		stats.LoadErrors += s.LoadErrors
+		stats.Refreshes += s.Refreshes
+		stats.RefreshErrors += s.RefreshErrors
+		stats.Size += s.Size
+		stats.Weight += s.Weight
+		stats.Limit += s.Limit
+		for reason, count := range s.Evictions {
+			stats.Evictions[reason] += count
+		}
+	}
+	return stats
+}
+
+func (c *ShardedTyped[K, V]) Close() {
+	for _, shard := range c.shards {
+		shard.Close()
+	}
+}
+
+func (c *ShardedTyped[K, V]) ShardCount() int {
+	return len(c.shards)
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSharded(t *testing.T) {
+	cache := NewSharded(4, 10, WithEvictionPolicy(LRU))
+
+	if e, a := int64(10), cache.CacheLimit(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	for i := 0; i < 100; i++ {
+		cache.Add(i, i*10)
+	}
+
+	stats := cache.Stats()
+	if stats.Size > 10 {
+		t.Errorf("size %v exceeds the limit %v", stats.Size, 10)
+	}
+	if e, a := 100-stats.Size, stats.Evictions[ReasonCapacity]; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	for _, key := range cache.Keys() {
+		a, ok := cache.Get(key)
+		if !ok {
+			t.Errorf("expected key to be present: %v", key)
+		}
+		if e := key.(int) * 10; !reflect.DeepEqual(e, a) {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+	}
+
+	old := cache.UpdateCacheLimit(4)
+	if e, a := int64(10), old; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if a := len(cache.Keys()); a > 4 {
+		t.Errorf("size %v exceeds the limit %v", a, 4)
+	}
+}
+
+func TestShardedTyped(t *testing.T) {
+	cache := NewShardedTyped[string, string](3, 100)
+
+	keys := []string{"bar", "baz", "foo", "moo", "qux"}
+	for _, key := range keys {
+		cache.Add(key, key)
+	}
+	cache.Delete("moo")
+
+	a, err := cache.GetOrLoad(context.TODO(), "zoo", func(ctx context.Context) (string, error) {
+		return "zoo", nil
+	})
+	if err != nil || a != "zoo" {
+		t.Errorf("expected %v, but received %v %v", "zoo", a, err)
+	}
+
+	actual := cache.Keys()
+	sort.Strings(actual)
+	if e := []string{"bar", "baz", "foo", "qux", "zoo"}; !reflect.DeepEqual(e, actual) {
+		t.Errorf("expected %v, but received %v", e, actual)
+	}
+}
+
+func TestShardLimit(t *testing.T) {
+	cases := []struct {
+		limit      int64
+		shardCount int
+	}{
+		{limit: 10, shardCount: 4},
+		{limit: 3, shardCount: 8},
+		{limit: 500, shardCount: 16},
+	}
+
+	for _, c := range cases {
+		var total int64
+		for i := 0; i < c.shardCount; i++ {
+			total += shardLimit(c.limit, c.shardCount, i)
+		}
+		if e, a := c.limit, total; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+	}
+}
+
+// TestSharded_SmallLimit keeps the cache within a limit smaller than the number of the shards.
+func TestSharded_SmallLimit(t *testing.T) {
+	cache := NewShardedTyped[int, int](8, 3)
+	for i := 0; i < 100; i++ {
+		cache.Add(i, i)
+	}
+	if a := len(cache.Keys()); a > 3 {
+		t.Errorf("expected at most %v entries, but received %v", 3, a)
+	}
+
+	cache.UpdateCacheLimit(100)
+	for i := 0; i < 100; i++ {
+		cache.Add(i, i)
+	}
+	// all the shards are used again
+	if a := len(cache.Keys()); a <= 8 || a > 100 {
+		t.Errorf("expected more than %v entries up to %v, but received %v", 8, 100, a)
+	}
+
+	cache.UpdateCacheLimit(2)
+	for i := 0; i < 100; i++ {
+		cache.Add(i, i)
+	}
+	if a := len(cache.Keys()); a > 2 {
+		t.Errorf("expected at most %v entries, but received %v", 2, a)
+	}
+	for _, key := range cache.Keys() {
+		if _, found := cache.Get(key); !found {
+			t.Errorf("expected key to be present: %v", key)
+		}
+	}
+}
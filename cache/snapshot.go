@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/hxy1991/sdk-go/codec"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// A snapshot is the header
+//
+//	magic "SDKCACHE" | version uint16 | content type length uint16 | content type | entry count uint64
+//
+// followed by the entries
+//
+//	key length uint32 | key | value length uint32 | value | expireAt int64
+//
+// all in big endian. The keys are encoded as JSON, the values by the snapshot codec whose
+// content type is in the header, and expireAt is in unix nanoseconds, zero means never.
+// As JSON does not keep the types of the keys of the untyped Cache, only its string keys are supported.
+const (
+	snapshotMagic   = "SDKCACHE"
+	snapshotVersion = uint16(1)
+	// snapshotMaxLength bounds a key or a value, so that a corrupt length does not allocate at will
+	snapshotMaxLength = 64 << 20
+)
+
+var (
+	ErrInvalidSnapshot = errors.New("cache: invalid snapshot")
+	// ErrSnapshotKey is returned by SaveSnapshot of the untyped Cache for a key which is not a string
+	ErrSnapshotKey = errors.New("cache: only string keys of the untyped cache can be saved in a snapshot")
+)
+
+// SaveSnapshot writes the entries which have not expired to w, keeping their expiry.
+// The keys of the untyped Cache must be strings, see ErrSnapshotKey.
+func (c *Typed[K, V]) SaveSnapshot(w io.Writer) error {
+	return writeSnapshot(w, c.snapshotCodec, c.snapshotEntries())
+}
+
+// LoadSnapshot adds the entries of a snapshot written by SaveSnapshot, the entries which
+// have expired since are skipped. The limit and the eviction policy apply as for Add.
+func (c *Typed[K, V]) LoadSnapshot(r io.Reader) error {
+	return readSnapshot(r, c.snapshotCodec, c.restore)
+}
+
+// SaveSnapshotFile writes the snapshot to a temporary file which is then renamed to path,
+// so that a crash never leaves a partial snapshot behind.
+func (c *Typed[K, V]) SaveSnapshotFile(path string) error {
+	return saveSnapshotFile(path, c.SaveSnapshot)
+}
+
+func (c *Typed[K, V]) LoadSnapshotFile(path string) error {
+	return loadSnapshotFile(path, c.LoadSnapshot)
+}
+
+func (c *ShardedTyped[K, V]) SaveSnapshot(w io.Writer) error {
+	var entries []*entry[K, V]
+	for _, shard := range c.shards {
+		entries = append(entries, shard.snapshotEntries()...)
+	}
+	return writeSnapshot(w, c.shards[0].snapshotCodec, entries)
+}
+
+func (c *ShardedTyped[K, V]) LoadSnapshot(r io.Reader) error {
+	return readSnapshot(r, c.shards[0].snapshotCodec, func(key K, value V, expireAt int64) {
+		c.shard(key).restore(key, value, expireAt)
+	})
+}
+
+func (c *ShardedTyped[K, V]) SaveSnapshotFile(path string) error {
+	return saveSnapshotFile(path, c.SaveSnapshot)
+}
+
+func (c *ShardedTyped[K, V]) LoadSnapshotFile(path string) error {
+	return loadSnapshotFile(path, c.LoadSnapshot)
+}
+
+// snapshotEntries copies the entries which have not expired.
+func (c *Typed[K, V]) snapshotEntries() []*entry[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixNano()
+	entries := make([]*entry[K, V], 0, len(c.caches))
+	for _, e := range c.caches {
+		if !e.expired(now) {
+			entries = append(entries, &entry[K, V]{key: e.key, value: e.value, expireAt: e.expireAt})
+		}
+	}
+	return entries
+}
+
+// restore adds an entry of a snapshot unless it has expired.
+func (c *Typed[K, V]) restore(key K, value V, expireAt int64) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if expireAt > 0 && c.now().UnixNano() >= expireAt {
+		return
+	}
+	c.addExpireAt(key, value, expireAt)
+}
+
+func writeSnapshot[K comparable, V any](w io.Writer, snapshotCodec codec.Codec, entries []*entry[K, V]) error {
+	bw := bufio.NewWriter(w)
+
+	contentType := snapshotCodec.ContentType()
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	for _, v := range []interface{}{snapshotVersion, uint16(len(contentType))} {
+		if err := binary.Write(bw, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.WriteString(contentType); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.BigEndian, uint64(len(entries))); err != nil {
+		return err
+	}
+
+	untypedKeys := reflect.TypeOf((*K)(nil)).Elem().Kind() == reflect.Interface
+	for _, e := range entries {
+		if _, ok := interface{}(e.key).(string); untypedKeys && !ok {
+			return fmt.Errorf("%w: [%v] of %T", ErrSnapshotKey, e.key, e.key)
+		}
+		key, err := codec.JSON.Marshal(e.key)
+		if err != nil {
+			return fmt.Errorf("cache: encode key [%v] of the snapshot: %w", e.key, err)
+		}
+		value, err := snapshotCodec.Marshal(e.value)
+		if err != nil {
+			return fmt.Errorf("cache: encode value of key [%v] of the snapshot: %w", e.key, err)
+		}
+
+		if err := writeBytes(bw, key); err != nil {
+			return err
+		}
+		if err := writeBytes(bw, value); err != nil {
+			return err
+		}
+		if err := binary.Write(bw, binary.BigEndian, e.expireAt); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+func readSnapshot[K comparable, V any](r io.Reader, snapshotCodec codec.Codec, fn func(key K, value V, expireAt int64)) error {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return ErrInvalidSnapshot
+	}
+
+	var version, contentTypeLength uint16
+	if err := binary.Read(br, binary.BigEndian, &version); err != nil {
+		return ErrInvalidSnapshot
+	}
+	if version != snapshotVersion {
+		return fmt.Errorf("cache: unsupported snapshot version %d", version)
+	}
+	if err := binary.Read(br, binary.BigEndian, &contentTypeLength); err != nil {
+		return ErrInvalidSnapshot
+	}
+	contentType := make([]byte, contentTypeLength)
+	if _, err := io.ReadFull(br, contentType); err != nil {
+		return ErrInvalidSnapshot
+	}
+	if string(contentType) != snapshotCodec.ContentType() {
+		return fmt.Errorf("cache: snapshot of %s can not be decoded by the codec of %s", contentType, snapshotCodec.ContentType())
+	}
+
+	var count uint64
+	if err := binary.Read(br, binary.BigEndian, &count); err != nil {
+		return ErrInvalidSnapshot
+	}
+
+	for i := uint64(0); i < count; i++ {
+		keyBytes, err := readBytes(br)
+		if err != nil {
+			return err
+		}
+		valueBytes, err := readBytes(br)
+		if err != nil {
+			return err
+		}
+		var expireAt int64
+		if err := binary.Read(br, binary.BigEndian, &expireAt); err != nil {
+			return ErrInvalidSnapshot
+		}
+
+		var key K
+		if err := codec.JSON.Unmarshal(keyBytes, &key); err != nil {
+			return fmt.Errorf("cache: decode key of the snapshot: %w", err)
+		}
+		var value V
+		if err := snapshotCodec.Unmarshal(valueBytes, &value); err != nil {
+			return fmt.Errorf("cache: decode value of key [%v] of the snapshot: %w", key, err)
+		}
+
+		fn(key, value, expireAt)
+	}
+
+	return nil
+}
+
+func writeBytes(w io.Writer, data []byte) error {
+	if len(data) > snapshotMaxLength {
+		return fmt.Errorf("cache: %d bytes are too long for a snapshot", len(data))
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readBytes(r io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, ErrInvalidSnapshot
+	}
+	if length > snapshotMaxLength {
+		return nil, ErrInvalidSnapshot
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, ErrInvalidSnapshot
+	}
+	return data, nil
+}
+
+func saveSnapshotFile(path string, save func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := save(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	// 重命名前落盘，否则崩溃后可能留下空的快照
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func loadSnapshotFile(path string, load func(r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return load(f)
+}
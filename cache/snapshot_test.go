@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"github.com/hxy1991/sdk-go/codec"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTyped_Snapshot(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache := NewTyped[string, cacheEntity](10)
+	cache.now = clock.Now
+
+	cache.Add("foo", cacheEntity{Key: "foo", Value: "value0"})
+	cache.AddWithTTL("bar", cacheEntity{Key: "bar", Value: "value1"}, time.Minute)
+	cache.AddWithTTL("baz", cacheEntity{Key: "baz", Value: "value2"}, time.Second)
+
+	var buf bytes.Buffer
+	if err := cache.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Second)
+
+	restored := NewTyped[string, cacheEntity](10)
+	restored.now = clock.Now
+	if err := restored.LoadSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := restored.Keys()
+	sort.Strings(keys)
+	if e := []string{"bar", "foo"}; !reflect.DeepEqual(e, keys) {
+		t.Errorf("expected %v, but received %v", e, keys)
+	}
+	if a, _ := restored.Get("bar"); !reflect.DeepEqual(cacheEntity{Key: "bar", Value: "value1"}, a) {
+		t.Errorf("expected %v, but received %v", cacheEntity{Key: "bar", Value: "value1"}, a)
+	}
+
+	// the TTL is kept across the snapshot
+	clock.Advance(time.Minute)
+	if _, found := restored.Get("bar"); found {
+		t.Errorf("expected key to be expired: %q", "bar")
+	}
+	if _, found := restored.Get("foo"); !found {
+		t.Errorf("expected key to be present: %q", "foo")
+	}
+}
+
+func TestTyped_SnapshotProto(t *testing.T) {
+	cache := NewTyped[int, *wrapperspb.StringValue](10, WithSnapshotCodec(codec.Proto))
+	cache.Add(1, wrapperspb.String("value0"))
+
+	var buf bytes.Buffer
+	if err := cache.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// a snapshot can only be loaded with the codec which wrote it
+	if err := NewTyped[int, *wrapperspb.StringValue](10).LoadSnapshot(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Errorf("expected an error for a snapshot of another codec")
+	}
+
+	restored := NewTyped[int, *wrapperspb.StringValue](10, WithSnapshotCodec(codec.Proto))
+	if err := restored.LoadSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := restored.Get(1); a.GetValue() != "value0" {
+		t.Errorf("expected %v, but received %v", "value0", a.GetValue())
+	}
+}
+
+func TestTyped_LoadInvalidSnapshot(t *testing.T) {
+	cases := []string{
+		"",
+		"NOTCACHE",
+		snapshotMagic + "\x00\x02",
+		snapshotMagic + "\x00\x01\x00\x10application/json",
+		// a key longer than the limit
+		snapshotMagic + "\x00\x01\x00\x10application/json" + "\x00\x00\x00\x00\x00\x00\x00\x01" + "\xff\xff\xff\xff",
+	}
+
+	for i, c := range cases {
+		if err := NewTyped[string, string](10).LoadSnapshot(strings.NewReader(c)); err == nil {
+			t.Errorf("case %d, expected an error", i)
+		}
+	}
+}
+
+func TestCache_SnapshotKeys(t *testing.T) {
+	cache := New(10)
+	cache.Add("foo", "value0")
+	var buf bytes.Buffer
+	if err := cache.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored := New(10)
+	if err := restored.LoadSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := restored.Get("foo"); !ok || a != "value0" {
+		t.Errorf("expected %v, but received %v", "value0", a)
+	}
+
+	cache.Add(1, "value1")
+	if err := cache.SaveSnapshot(&buf); !errors.Is(err, ErrSnapshotKey) {
+		t.Errorf("expected %v, but received %v", ErrSnapshotKey, err)
+	}
+}
+
+func TestSharded_SnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	cache := NewShardedTyped[string, string](4, 100)
+	for _, key := range []string{"bar", "baz", "foo", "moo", "qux"} {
+		cache.Add(key, key)
+	}
+	if err := cache.SaveSnapshotFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewShardedTyped[string, string](2, 100)
+	if err := restored.LoadSnapshotFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := restored.Keys()
+	sort.Strings(keys)
+	if e := []string{"bar", "baz", "foo", "moo", "qux"}; !reflect.DeepEqual(e, keys) {
+		t.Errorf("expected %v, but received %v", e, keys)
+	}
+}
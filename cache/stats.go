@@ -0,0 +1,113 @@
+package cache
+
+import "fmt"
+
+type EvictionReason int
+
+const (
+	// ReasonCapacity means the entry was evicted because the cache limit was exceeded
+	ReasonCapacity EvictionReason = iota
+	// ReasonExpired means the TTL of the entry has passed
+	ReasonExpired
+	// ReasonDeleted means the entry was removed by Delete
+	ReasonDeleted
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case ReasonCapacity:
+		return "capacity"
+	case ReasonExpired:
+		return "expired"
+	case ReasonDeleted:
+		return "deleted"
+	default:
+		return fmt.Sprintf("EvictionReason(%d)", int(r))
+	}
+}
+
+// Stats is a snapshot of the counters of a cache, the counters only ever increase.
+type Stats struct {
+	Hits       int64
+	Misses     int64
+	Loads      int64
+	LoadErrors int64
+	// Refreshes is the number of finished refreshes, including the failed ones counted by RefreshErrors
+	Refreshes     int64
+	RefreshErrors int64
+	// Evictions is the number of removed entries by reason
+	Evictions map[EvictionReason]int64
+	Size      int64
+	// Weight is the total weight of the entries, it is always 0 without a weigher
+	Weight int64
+	Limit  int64
+}
+
+// HitRate returns the ratio of hits to lookups, or 0 if there was no lookup.
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+type counters struct {
+	hits          int64
+	misses        int64
+	loads         int64
+	loadErrors    int64
+	refreshes     int64
+	refreshErrors int64
+	evictions     map[EvictionReason]int64
+}
+
+func (c *Typed[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	evictions := make(map[EvictionReason]int64, len(c.counters.evictions))
+	for reason, count := range c.counters.evictions {
+		evictions[reason] = count
+	}
+
+	return Stats{
+		Hits:          c.counters.hits,
+		Misses:        c.counters.misses,
+		Loads:         c.counters.loads,
+		LoadErrors:    c.counters.loadErrors,
+		Refreshes:     c.counters.refreshes,
+		RefreshErrors: c.counters.refreshErrors,
+		Evictions:     evictions,
+		Size:          c.size,
+		Weight:        c.weight,
+		Limit:         c.cacheLimit,
+	}
+}
+
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictionReason
+}
+
+// unlock releases the lock and then calls the hooks for what happened while it was held,
+// so that a hook may use the cache without dead locking.
+func (c *Typed[K, V]) unlock() {
+	evicted := c.evicted
+	added := c.added
+	c.evicted = nil
+	c.added = nil
+	c.mu.Unlock()
+
+	if c.onEvict != nil {
+		for _, e := range evicted {
+			c.onEvict(e.key, e.value, e.reason)
+		}
+	}
+	if c.onAdd != nil {
+		for _, e := range added {
+			c.onAdd(e.key, e.value)
+		}
+	}
+}
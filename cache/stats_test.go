@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTyped_Stats(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache := NewTyped[string, string](2, WithEvictionPolicy(LRU))
+	cache.now = clock.Now
+
+	cache.Add("foo", "value0")
+	cache.Add("bar", "value1")
+	cache.Get("foo")
+	cache.Get("baz")
+	cache.Add("baz", "value2")
+	cache.AddWithTTL("qux", "value3", time.Second)
+	cache.Delete("baz")
+
+	_, _ = cache.GetOrLoad(context.TODO(), "moo", func(ctx context.Context) (string, error) {
+		return "", errors.New("load failed")
+	})
+
+	clock.Advance(time.Second)
+	cache.DeleteExpired()
+
+	e := Stats{
+		Hits:       1,
+		Misses:     2,
+		Loads:      1,
+		LoadErrors: 1,
+		Evictions: map[EvictionReason]int64{
+			ReasonCapacity: 2,
+			ReasonExpired:  1,
+			ReasonDeleted:  1,
+		},
+		Size:  0,
+		Limit: 2,
+	}
+	if a := cache.Stats(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %+v, but received %+v", e, a)
+	}
+	if e, a := 1.0/3.0, cache.Stats().HitRate(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestCache_OnEvict(t *testing.T) {
+	var mu sync.Mutex
+	evicted := map[interface{}]EvictionReason{}
+	var added []interface{}
+
+	var cache *Cache
+	cache = New(2,
+		WithEvictionPolicy(FIFO),
+		WithOnEvict(func(key, value interface{}, reason EvictionReason) {
+			// the hook is called without the lock, so using the cache must not dead lock
+			cache.Keys()
+
+			mu.Lock()
+			defer mu.Unlock()
+			evicted[key] = reason
+		}),
+		WithOnAdd(func(key, value interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			added = append(added, key)
+		}),
+	)
+
+	cache.Add("foo", "value0")
+	cache.Add("bar", "value1")
+	cache.Add("baz", "value2")
+	cache.Delete("bar")
+
+	e := map[interface{}]EvictionReason{
+		"foo": ReasonCapacity,
+		"bar": ReasonDeleted,
+	}
+	if !reflect.DeepEqual(e, evicted) {
+		t.Errorf("expected %v, but received %v", e, evicted)
+	}
+	if e, a := []interface{}{"foo", "bar", "baz"}, added; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestTyped_OnEvictTypeMismatch(t *testing.T) {
+	defer func() {
+		if e := recover(); e == nil {
+			t.Errorf("expected a panic for a hook of the wrong type")
+		}
+	}()
+
+	NewTyped[string, int](2, WithOnEvict(func(key string, value string, reason EvictionReason) {}))
+}
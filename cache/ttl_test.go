@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+func TestCache_AddWithTTL(t *testing.T) {
+	cases := []struct {
+		defaultTTL    time.Duration
+		ttls          map[string]time.Duration
+		advance       time.Duration
+		expectedFound map[string]bool
+		expectedSize  int64
+	}{
+		{
+			defaultTTL:    0,
+			ttls:          map[string]time.Duration{"foo": time.Second, "bar": time.Minute, "baz": 0},
+			advance:       time.Second,
+			expectedFound: map[string]bool{"foo": false, "bar": true, "baz": true},
+			expectedSize:  2,
+		},
+		{
+			defaultTTL:    time.Second,
+			ttls:          map[string]time.Duration{"foo": 2 * time.Second},
+			advance:       time.Second,
+			expectedFound: map[string]bool{"foo": true, "bar": false},
+			expectedSize:  1,
+		},
+	}
+
+	for i, c := range cases {
+		clock := &fakeClock{now: time.Unix(0, 0)}
+		cache := New(10, WithDefaultTTL(c.defaultTTL))
+		cache.now = clock.Now
+
+		for key, ttl := range c.ttls {
+			cache.AddWithTTL(key, key, ttl)
+		}
+		cache.Add("bar", "bar")
+
+		clock.Advance(c.advance)
+
+		for key, expected := range c.expectedFound {
+			if _, found := cache.Get(key); found != expected {
+				t.Errorf("case %d, key %q, expected %v, but received %v", i, key, expected, found)
+			}
+		}
+
+		if e, a := c.expectedSize, cache.size; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestCache_DeleteExpired(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache := New(10)
+	cache.now = clock.Now
+
+	cache.AddWithTTL("foo", "value0", time.Second)
+	cache.AddWithTTL("bar", "value1", time.Minute)
+	cache.Add("baz", "value2")
+
+	clock.Advance(time.Second)
+
+	if e, a := 2, len(cache.Keys()); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	cache.DeleteExpired()
+
+	if e, a := int64(2), cache.size; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestCache_CleanupInterval(t *testing.T) {
+	cache := New(10, WithDefaultTTL(10*time.Millisecond), WithCleanupInterval(10*time.Millisecond))
+	defer cache.Close()
+
+	cache.Add("foo", "value0")
+	cache.Add("bar", "value1")
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		cache.mu.Lock()
+		size := cache.size
+		cache.mu.Unlock()
+
+		if size == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("expected the janitor to remove the expired entries")
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/hxy1991/sdk-go/codec"
+	"github.com/hxy1991/sdk-go/log"
+	"strings"
+	"time"
+)
+
+// Backend is a remote tier shared by all the instances of a service, e.g. redis.Client.
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value, a ttl <= 0 means the value never expires
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Invalidator is implemented by the backends which can broadcast messages to all the instances.
+type Invalidator interface {
+	Publish(ctx context.Context, message string) error
+	// Subscribe calls handler for every published message until ctx is done, and onResubscribe after
+	// the subscription comes back from a lost connection, the messages published meanwhile are lost
+	Subscribe(ctx context.Context, handler func(message string), onResubscribe func()) error
+}
+
+// TwoTier keeps an in-process Typed cache in front of a remote Backend. A value written
+// by one instance is published as an invalidation, so that the other instances drop
+// their local copy and read the new value from the remote tier.
+type TwoTier[V any] struct {
+	local      *Typed[string, V]
+	remote     Backend
+	codec      codec.Codec
+	remoteTTL  time.Duration
+	instanceId string
+	cancel     context.CancelFunc
+}
+
+// NewTwoTier uses codec to store the values in remote, which keeps them for remoteTTL.
+// If remote is an Invalidator, NewTwoTier subscribes to the invalidations until Close, and clears
+// the local tier whenever the subscription is lost, since the invalidations meanwhile are missed.
+func NewTwoTier[V any](local *Typed[string, V], remote Backend, codec codec.Codec, remoteTTL time.Duration) (*TwoTier[V], error) {
+	c := &TwoTier[V]{
+		local:      local,
+		remote:     remote,
+		codec:      codec,
+		remoteTTL:  remoteTTL,
+		instanceId: uuid.NewString(),
+	}
+
+	if invalidator, ok := remote.(Invalidator); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		err := invalidator.Subscribe(ctx, c.onInvalidation, c.onResubscribe)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		c.cancel = cancel
+	}
+
+	return c, nil
+}
+
+// Get reads the local tier first and then the remote tier, a remote hit is kept locally.
+func (c *TwoTier[V]) Get(ctx context.Context, key string) (V, bool, error) {
+	if value, found := c.local.Get(key); found {
+		return value, true, nil
+	}
+
+	value, found, err := c.getRemote(ctx, key)
+	if err != nil || !found {
+		return value, false, err
+	}
+
+	c.local.Add(key, value)
+	return value, true, nil
+}
+
+// GetOrLoad is Get which calls loader on a miss of both tiers and stores its result in both,
+// concurrent misses of the same key in this instance share one remote read and load.
+func (c *TwoTier[V]) GetOrLoad(ctx context.Context, key string, loader func(ctx context.Context) (V, error)) (V, error) {
+	return c.local.GetOrLoad(ctx, key, func(ctx context.Context) (V, error) {
+		value, found, err := c.getRemote(ctx, key)
+		if err != nil {
+			// the remote tier is only an optimization, fall back to the loader
+			log.Warn("get [", key, "] from the remote cache error ", err)
+		}
+		if found {
+			return value, nil
+		}
+
+		value, err = loader(ctx)
+		if err != nil {
+			return value, err
+		}
+
+		if err := c.setRemote(ctx, key, value); err != nil {
+			log.Warn("set [", key, "] to the remote cache error ", err)
+		}
+		return value, nil
+	})
+}
+
+// Add writes the value to both tiers and invalidates the local copy of the other instances.
+func (c *TwoTier[V]) Add(ctx context.Context, key string, value V) error {
+	if err := c.setRemote(ctx, key, value); err != nil {
+		return err
+	}
+	c.local.Add(key, value)
+	return c.publish(ctx, key)
+}
+
+// Delete removes the value from both tiers and from the local tier of the other instances.
+func (c *TwoTier[V]) Delete(ctx context.Context, key string) error {
+	c.local.Delete(key)
+	if err := c.remote.Delete(ctx, key); err != nil {
+		return err
+	}
+	return c.publish(ctx, key)
+}
+
+// Local returns the in-process tier.
+func (c *TwoTier[V]) Local() *Typed[string, V] {
+	return c.local
+}
+
+// Close stops the subscription to the invalidations.
+func (c *TwoTier[V]) Close() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+func (c *TwoTier[V]) getRemote(ctx context.Context, key string) (V, bool, error) {
+	var value V
+
+	data, found, err := c.remote.Get(ctx, key)
+	if err != nil || !found {
+		return value, false, err
+	}
+
+	if err := c.codec.Unmarshal(data, &value); err != nil {
+		return value, false, err
+	}
+	return value, true, nil
+}
+
+func (c *TwoTier[V]) setRemote(ctx context.Context, key string, value V) error {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.remote.Set(ctx, key, data, c.remoteTTL)
+}
+
+// publish broadcasts "instanceId:key", so that an instance can skip its own invalidations.
+func (c *TwoTier[V]) publish(ctx context.Context, key string) error {
+	invalidator, ok := c.remote.(Invalidator)
+	if !ok {
+		return nil
+	}
+	return invalidator.Publish(ctx, c.instanceId+":"+key)
+}
+
+func (c *TwoTier[V]) onInvalidation(message string) {
+	instanceId, key, ok := strings.Cut(message, ":")
+	if !ok || instanceId == c.instanceId {
+		return
+	}
+	c.local.Delete(key)
+}
+
+func (c *TwoTier[V]) onResubscribe() {
+	keys := c.local.Keys()
+	for _, key := range keys {
+		c.local.Delete(key)
+	}
+	log.Warn("clear ", len(keys), " local cache keys which missed the invalidations")
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"github.com/hxy1991/sdk-go/cache/redis"
+	"github.com/hxy1991/sdk-go/cache/redis/redistest"
+	"github.com/hxy1991/sdk-go/codec"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTwoTier(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.TODO()
+	newTwoTier := func() *TwoTier[cacheEntity] {
+		c, err := NewTwoTier[cacheEntity](NewTyped[string, cacheEntity](10), redis.New(s.Addr), codec.JSON, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		return c
+	}
+	instance1 := newTwoTier()
+	instance2 := newTwoTier()
+
+	e := cacheEntity{Key: "foo", Value: "value0"}
+	if err := instance1.Add(ctx, "foo", e); err != nil {
+		t.Fatal(err)
+	}
+
+	// instance2 misses locally and reads the remote tier
+	a, found, err := instance2.Get(ctx, "foo")
+	if err != nil || !found {
+		t.Fatalf("expected key to be present: %q, %v", "foo", err)
+	}
+	if !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if _, found := instance2.Local().Get("foo"); !found {
+		t.Errorf("expected the remote hit to be kept locally")
+	}
+
+	// a new value written by instance1 invalidates the local copy of instance2
+	e = cacheEntity{Key: "foo", Value: "value1"}
+	if err := instance1.Add(ctx, "foo", e); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, found := instance2.Local().Get("foo"); !found {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	a, _, _ = instance2.Get(ctx, "foo")
+	if !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if _, found := instance1.Local().Get("foo"); !found {
+		t.Errorf("expected an instance to ignore its own invalidation")
+	}
+
+	if err := instance2.Delete(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := s.Get("foo"); found {
+		t.Errorf("expected key to be deleted remotely: %q", "foo")
+	}
+}
+
+func TestTwoTier_GetOrLoad(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.TODO()
+	loads := 0
+	loader := func(ctx context.Context) (*wrapperspb.StringValue, error) {
+		loads++
+		return wrapperspb.String("value0"), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		// a new instance each time, the second one is served by the remote tier
+		c, err := NewTwoTier[*wrapperspb.StringValue](NewTyped[string, *wrapperspb.StringValue](10), redis.New(s.Addr), codec.Proto, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := c.GetOrLoad(ctx, "foo", loader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := "value0"; e != a.GetValue() {
+			t.Errorf("expected %v, but received %v", e, a.GetValue())
+		}
+		c.Close()
+	}
+
+	if e, a := 1, loads; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+// TestTwoTier_Resubscribe clears the local tier once the subscription comes back, since the
+// invalidations published meanwhile are lost.
+func TestTwoTier_Resubscribe(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c, err := NewTwoTier[cacheEntity](NewTyped[string, cacheEntity](10), redis.New(s.Addr), codec.JSON, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Add(context.TODO(), "foo", cacheEntity{Key: "foo", Value: "value0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.CloseClientConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, found := c.Local().Get("foo"); !found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expected the local tier to be cleared after resubscribing")
+}
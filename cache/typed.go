@@ -0,0 +1,412 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/hxy1991/sdk-go/codec"
+	"github.com/hxy1991/sdk-go/ticker"
+	"sync"
+	"time"
+)
+
+// Typed is a type-safe cache, Cache is a Typed with interface{} keys and values.
+type Typed[K comparable, V any] struct {
+	mu     sync.Mutex
+	caches map[K]*entry[K, V]
+	// cacheLimit is the max number of entries, or the max total weight when weigher is set
+	cacheLimit int64
+	// size is used to count the number elements in the cache.
+	size int64
+	// weight is the total weight of the entries, only counted when weigher is set
+	weight  int64
+	weigher func(key K, value V) int64
+
+	evictionPolicy EvictionPolicy
+	policy         policy[K, V]
+
+	// defaultTTL is used by Add, zero means the entries never expire
+	defaultTTL time.Duration
+	janitor    *ticker.Ticker
+	now        func() time.Time
+
+	// loads are the in-flight loads of GetOrLoad, failures are the cached loader errors
+	loads       map[K]*call[V]
+	failures    map[K]*failure
+	negativeTTL time.Duration
+
+	snapshotCodec codec.Codec
+
+	// refreshInterval and refresher apply to the entries which were not added by AddWithRefresh
+	refreshInterval time.Duration
+	refresher       func(ctx context.Context, key K, old V) (V, error)
+	onRefreshError  func(key K, err error)
+	// refreshTokens bounds the number of concurrent background refreshes
+	refreshTokens chan struct{}
+	sweeper       *ticker.Ticker
+	closed        bool
+	// refreshCtx is the context of the background refreshes, Close cancels it and waits for refreshes
+	refreshCtx  context.Context
+	stopRefresh context.CancelFunc
+	refreshes   sync.WaitGroup
+
+	counters counters
+	onEvict  func(key K, value V, reason EvictionReason)
+	onAdd    func(key K, value V)
+	// evicted and added are collected while the lock is held and passed to the hooks by unlock
+	evicted []eviction[K, V]
+	added   []*entry[K, V]
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	// expireAt is in unix nanoseconds, zero means the entry never expires
+	expireAt int64
+	weight   int64
+	// ttl is applied again when the entry is refreshed
+	ttl time.Duration
+
+	// refreshInterval and refresher override those of the cache, see AddWithRefresh
+	refreshInterval time.Duration
+	refresher       func(ctx context.Context, key K, old V) (V, error)
+	// refreshAt is in unix nanoseconds, zero means the entry is never refreshed
+	refreshAt  int64
+	refreshing bool
+	// generation changes whenever the value is written, a refresh of an older generation is discarded
+	generation uint64
+
+	// bookkeeping of the eviction policy
+	element *list.Element
+	bucket  *list.Element
+	index   int
+}
+
+func NewTyped[K comparable, V any](cacheLimit int64, opts ...Option) *Typed[K, V] {
+	cfg := newConfig(opts...)
+
+	c := &Typed[K, V]{
+		cacheLimit:     cacheLimit,
+		caches:         map[K]*entry[K, V]{},
+		evictionPolicy: cfg.evictionPolicy,
+		policy:         newPolicy[K, V](cfg.evictionPolicy),
+		defaultTTL:     cfg.defaultTTL,
+		now:            time.Now,
+		loads:          map[K]*call[V]{},
+		failures:       map[K]*failure{},
+		negativeTTL:    cfg.negativeTTL,
+		snapshotCodec:  cfg.snapshotCodec,
+		refreshTokens:  make(chan struct{}, cfg.refreshConcurrency),
+		counters: counters{
+			evictions: map[EvictionReason]int64{},
+		},
+	}
+	c.refreshCtx, c.stopRefresh = context.WithCancel(context.Background())
+
+	if cfg.onEvict != nil {
+		onEvict, ok := cfg.onEvict.(func(key K, value V, reason EvictionReason))
+		if !ok {
+			panic(fmt.Sprintf("cache: OnEvict hook %T does not match the cache of %T", cfg.onEvict, c))
+		}
+		c.onEvict = onEvict
+	}
+
+	if cfg.weigher != nil {
+		weigher, ok := cfg.weigher.(func(key K, value V) int64)
+		if !ok {
+			panic(fmt.Sprintf("cache: weigher %T does not match the cache of %T", cfg.weigher, c))
+		}
+		c.weigher = weigher
+	}
+
+	if cfg.onAdd != nil {
+		onAdd, ok := cfg.onAdd.(func(key K, value V))
+		if !ok {
+			panic(fmt.Sprintf("cache: OnAdd hook %T does not match the cache of %T", cfg.onAdd, c))
+		}
+		c.onAdd = onAdd
+	}
+
+	if cfg.refresher != nil {
+		refresher, ok := cfg.refresher.(func(ctx context.Context, key K, old V) (V, error))
+		if !ok {
+			panic(fmt.Sprintf("cache: refresher %T does not match the cache of %T", cfg.refresher, c))
+		}
+		c.refresher = refresher
+		c.refreshInterval = cfg.refreshInterval
+		c.sweepEvery(cfg.refreshInterval)
+	}
+
+	if cfg.onRefreshError != nil {
+		onRefreshError, ok := cfg.onRefreshError.(func(key K, err error))
+		if !ok {
+			panic(fmt.Sprintf("cache: OnRefreshError hook %T does not match the cache of %T", cfg.onRefreshError, c))
+		}
+		c.onRefreshError = onRefreshError
+	}
+
+	if cfg.cleanupInterval > 0 {
+		c.janitor = ticker.New(cfg.cleanupInterval, func() {
+			c.DeleteExpired()
+		})
+		c.janitor.Start()
+	}
+
+	return c
+}
+
+func (c *Typed[K, V]) Get(cacheKey K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	value, found := c.get(cacheKey)
+	if found {
+		c.counters.hits++
+	} else {
+		c.counters.misses++
+	}
+	return value, found
+}
+
+// get returns the value which has not expired. The lock must be held.
+func (c *Typed[K, V]) get(cacheKey K) (V, bool) {
+	e, found := c.caches[cacheKey]
+	if !found {
+		var zero V
+		return zero, false
+	}
+	now := c.now().UnixNano()
+	if e.expired(now) {
+		// 惰性删除过期的 key
+		c.remove(e, ReasonExpired)
+		var zero V
+		return zero, false
+	}
+	c.policy.access(e)
+	if c.refreshDue(e, now) {
+		// 先返回旧值，后台刷新
+		c.refreshAsync(e)
+	}
+	return e.value, true
+}
+
+// Add adds the value with the default TTL of the cache.
+func (c *Typed[K, V]) Add(cacheKey K, cacheValue V) {
+	c.AddWithTTL(cacheKey, cacheValue, c.defaultTTL)
+}
+
+// AddWithTTL adds the value which expires after ttl, a ttl <= 0 means the value never expires.
+func (c *Typed[K, V]) AddWithTTL(cacheKey K, cacheValue V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.add(cacheKey, cacheValue, ttl)
+}
+
+// add adds or replaces the value and returns the entry. The lock must be held.
+func (c *Typed[K, V]) add(cacheKey K, cacheValue V, ttl time.Duration) *entry[K, V] {
+	var expireAt int64
+	if ttl > 0 {
+		expireAt = c.now().Add(ttl).UnixNano()
+	}
+
+	e := c.addExpireAt(cacheKey, cacheValue, expireAt)
+	e.ttl = ttl
+	return e
+}
+
+// addExpireAt adds or replaces the value which expires at expireAt in unix nanoseconds,
+// zero means never, and returns the entry. The lock must be held.
+func (c *Typed[K, V]) addExpireAt(cacheKey K, cacheValue V, expireAt int64) *entry[K, V] {
+	delete(c.failures, cacheKey)
+
+	var weight int64
+	if c.weigher != nil {
+		weight = c.weigher(cacheKey, cacheValue)
+	}
+
+	e, found := c.caches[cacheKey]
+	if found {
+		// 原来存在这个 Key
+		c.weight += weight - e.weight
+		e.value = cacheValue
+		e.expireAt = expireAt
+		e.weight = weight
+		e.generation++
+		c.scheduleRefresh(e)
+		c.policy.access(e)
+		c.notifyAdd(e)
+
+		c.evict(e)
+		return e
+	}
+
+	// 原本不存在这个 key
+	e = &entry[K, V]{
+		key:      cacheKey,
+		value:    cacheValue,
+		expireAt: expireAt,
+		weight:   weight,
+	}
+	c.scheduleRefresh(e)
+	c.caches[cacheKey] = e
+	c.policy.add(e)
+	c.size++
+	c.weight += weight
+	c.notifyAdd(e)
+
+	c.evict(e)
+	return e
+}
+
+// notifyAdd queues the OnAdd hook. The lock must be held.
+func (c *Typed[K, V]) notifyAdd(e *entry[K, V]) {
+	if c.onAdd != nil {
+		c.added = append(c.added, &entry[K, V]{key: e.key, value: e.value})
+	}
+}
+
+// usage is what is compared to cacheLimit. The lock must be held.
+func (c *Typed[K, V]) usage() int64 {
+	if c.weigher != nil {
+		return c.weight
+	}
+	return c.size
+}
+
+// evict removes entries chosen by the eviction policy until the usage of the cache
+// fits the limit, the entry butNot is never evicted. The lock must be held.
+func (c *Typed[K, V]) evict(butNot *entry[K, V]) {
+	for c.usage() > 0 && c.usage() > c.cacheLimit {
+		victim := c.policy.victim(butNot)
+		if victim == nil {
+			return
+		}
+		c.remove(victim, ReasonCapacity)
+	}
+}
+
+// remove deletes the entry from the cache. The lock must be held.
+func (c *Typed[K, V]) remove(e *entry[K, V], reason EvictionReason) {
+	delete(c.caches, e.key)
+	c.policy.remove(e)
+	c.size--
+	c.weight -= e.weight
+
+	c.counters.evictions[reason]++
+	if c.onEvict != nil {
+		c.evicted = append(c.evicted, eviction[K, V]{key: e.key, value: e.value, reason: reason})
+	}
+}
+
+func (c *Typed[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	delete(c.failures, key)
+	e, found := c.caches[key]
+	if found {
+		c.remove(e, ReasonDeleted)
+	}
+}
+
+// DeleteExpired removes all the expired entries, it is called periodically when the cleanup interval is set.
+func (c *Typed[K, V]) DeleteExpired() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	now := c.now().UnixNano()
+	for _, e := range c.caches {
+		if e.expired(now) {
+			c.remove(e, ReasonExpired)
+		}
+	}
+	for key, f := range c.failures {
+		if now >= f.expireAt {
+			delete(c.failures, key)
+		}
+	}
+}
+
+// Keys returns the keys of the entries which have not expired.
+func (c *Typed[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixNano()
+	var keys []K
+	for key, e := range c.caches {
+		if !e.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// UpdateCacheLimit changes the max number of entries, or the max total weight when a weigher is set,
+// and evicts entries right away if the cache exceeds the new limit.
+func (c *Typed[K, V]) UpdateCacheLimit(cacheLimit int64) int64 {
+	c.mu.Lock()
+	defer c.unlock()
+
+	oldCacheLimit := c.cacheLimit
+	c.cacheLimit = cacheLimit
+
+	c.evict(nil)
+
+	return oldCacheLimit
+}
+
+func (c *Typed[K, V]) CacheLimit() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cacheLimit
+}
+
+// Weight returns the total weight of the entries, it is always 0 without a weigher.
+func (c *Typed[K, V]) Weight() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weight
+}
+
+func (c *Typed[K, V]) EvictionPolicy() EvictionPolicy {
+	return c.evictionPolicy
+}
+
+// Close stops the background cleanup and refresh, it cancels the context of the background refreshes
+// and waits for them. The cache itself is still usable afterwards.
+func (c *Typed[K, V]) Close() {
+	if c.janitor != nil {
+		c.janitor.Stop()
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	if c.sweeper != nil {
+		c.sweeper.Stop()
+	}
+	c.mu.Unlock()
+
+	c.stopRefresh()
+	c.refreshes.Wait()
+}
+
+// rangeEntries calls fn for every entry without touching the eviction policy,
+// iteration stops when fn returns false.
+func (c *Typed[K, V]) rangeEntries(fn func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, e := range c.caches {
+		if !fn(key, e.value) {
+			return
+		}
+	}
+}
+
+func (e *entry[K, V]) expired(now int64) bool {
+	return e.expireAt > 0 && now >= e.expireAt
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTyped(t *testing.T) {
+	cases := []struct {
+		limit        int64
+		adds         map[string]cacheEntity
+		deletedKeys  []string
+		expectedKeys []string
+	}{
+		{
+			limit: 5,
+			adds: map[string]cacheEntity{
+				"foo": {Key: "foo", Value: "value0"},
+				"bar": {Key: "bar", Value: "value1"},
+				"baz": {Key: "baz", Value: "value2"},
+			},
+			deletedKeys:  []string{"bar"},
+			expectedKeys: []string{"baz", "foo"},
+		},
+		{
+			limit: 1,
+			adds: map[string]cacheEntity{
+				"foo": {Key: "foo", Value: "value0"},
+				"bar": {Key: "bar", Value: "value1"},
+			},
+			expectedKeys: nil,
+		},
+	}
+
+	for i, c := range cases {
+		cache := NewTyped[string, cacheEntity](c.limit, WithEvictionPolicy(LRU))
+
+		for key, entity := range c.adds {
+			cache.Add(key, entity)
+		}
+		for _, key := range c.deletedKeys {
+			cache.Delete(key)
+		}
+
+		keys := cache.Keys()
+		sort.Strings(keys)
+
+		if c.expectedKeys != nil && !reflect.DeepEqual(c.expectedKeys, keys) {
+			t.Errorf("case %d, expected %v, but received %v", i, c.expectedKeys, keys)
+		}
+		if e, a := c.limit, cache.size; a > e {
+			t.Errorf("case %d, size %v exceeds the limit %v", i, a, e)
+		}
+
+		for _, key := range keys {
+			a, ok := cache.Get(key)
+			if !ok {
+				t.Errorf("case %d, expected key to be present: %q", i, key)
+			}
+			if e := c.adds[key]; !reflect.DeepEqual(e, a) {
+				t.Errorf("case %d, expected %v, but received %v", i, e, a)
+			}
+		}
+	}
+}
+
+func TestTyped_GetMissing(t *testing.T) {
+	cache := NewTyped[int, *cacheEntity](5)
+
+	a, ok := cache.Get(1)
+	if ok {
+		t.Errorf("expected key to be missing: %d", 1)
+	}
+	if a != nil {
+		t.Errorf("expected the zero value, but received %v", a)
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestTyped_Weigher(t *testing.T) {
+	cases := []struct {
+		limit          int64
+		adds           []cacheEntity
+		newLimit       int64
+		expectedKeys   []string
+		expectedWeight int64
+	}{
+		{
+			limit: 10,
+			adds: []cacheEntity{
+				{Key: "foo", Value: "1234"},
+				{Key: "bar", Value: "1234"},
+				{Key: "baz", Value: "1234"},
+			},
+			expectedKeys:   []string{"bar", "baz"},
+			expectedWeight: 8,
+		},
+		{
+			limit: 10,
+			adds: []cacheEntity{
+				{Key: "foo", Value: "12"},
+				{Key: "bar", Value: "12"},
+				{Key: "baz", Value: "12"},
+				{Key: "foo", Value: "1234567"},
+			},
+			expectedKeys:   []string{"baz", "foo"},
+			expectedWeight: 9,
+		},
+		{
+			limit: 10,
+			adds: []cacheEntity{
+				{Key: "foo", Value: "123"},
+				{Key: "bar", Value: "123"},
+				{Key: "baz", Value: "123"},
+			},
+			newLimit:       4,
+			expectedKeys:   []string{"baz"},
+			expectedWeight: 3,
+		},
+		{
+			limit: 10,
+			adds: []cacheEntity{
+				{Key: "foo", Value: "123"},
+				{Key: "bar", Value: "123456789012"},
+			},
+			expectedKeys:   []string{"bar"},
+			expectedWeight: 12,
+		},
+	}
+
+	for i, c := range cases {
+		cache := NewTyped[string, string](c.limit,
+			WithEvictionPolicy(FIFO),
+			WithWeigher(func(key string, value string) int64 {
+				return int64(len(value))
+			}),
+		)
+
+		for _, entity := range c.adds {
+			cache.Add(entity.Key, entity.Value)
+		}
+		if c.newLimit != 0 {
+			cache.UpdateCacheLimit(c.newLimit)
+		}
+
+		keys := cache.Keys()
+		sort.Strings(keys)
+
+		if e, a := fmt.Sprint(c.expectedKeys), fmt.Sprint(keys); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		if e, a := c.expectedWeight, cache.Weight(); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
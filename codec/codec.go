@@ -0,0 +1,87 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hxy1991/sdk-go/utils"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+)
+
+// Codec turns values into bytes and back, it is used wherever a value leaves the process.
+type Codec interface {
+	// ContentType is the MIME type of the encoded bytes, e.g. "application/json"
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v, which must be a pointer
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSON  Codec = jsonCodec{}
+	Proto Codec = protoCodec{}
+)
+
+// ByContentType returns the built-in codec of contentType, or nil if there is none.
+func ByContentType(contentType string) Codec {
+	switch contentType {
+	case JSON.ContentType():
+		return JSON
+	case Proto.ContentType():
+		return Proto
+	default:
+		return nil
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// protoCodec encodes with utils.MessageToBytes, the values must be proto.Message.
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("codec: %T is not a proto.Message", v)
+	}
+	return utils.MessageToBytes(msg)
+}
+
+// Unmarshal accepts a proto.Message, or a pointer to a proto.Message pointer which is
+// allocated when nil, so that a generic *V with V = *pb.Foo can be decoded as well.
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	if msg, ok := v.(proto.Message); ok {
+		return utils.BytesToMessage(data, msg)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Ptr {
+		return fmt.Errorf("codec: %T is not a proto.Message", v)
+	}
+
+	elem := rv.Elem()
+	if elem.IsNil() {
+		elem.Set(reflect.New(elem.Type().Elem()))
+	}
+	msg, ok := elem.Interface().(proto.Message)
+	if !ok {
+		return fmt.Errorf("codec: %T is not a proto.Message", v)
+	}
+	return utils.BytesToMessage(data, msg)
+}
@@ -0,0 +1,76 @@
+package codec
+
+import (
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"reflect"
+	"testing"
+)
+
+type entity struct {
+	Key   string
+	Value string
+}
+
+func TestJSON(t *testing.T) {
+	e := entity{Key: "foo", Value: "value0"}
+
+	data, err := JSON.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a entity
+	if err := JSON.Unmarshal(data, &a); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestProto(t *testing.T) {
+	e := wrapperspb.String("value0")
+
+	data, err := Proto.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &wrapperspb.StringValue{}
+	if err := Proto.Unmarshal(data, a); err != nil {
+		t.Fatal(err)
+	}
+	if e.GetValue() != a.GetValue() {
+		t.Errorf("expected %v, but received %v", e.GetValue(), a.GetValue())
+	}
+
+	// a generic value of type *wrapperspb.StringValue is decoded through a pointer to it
+	var p *wrapperspb.StringValue
+	if err := Proto.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p == nil || e.GetValue() != p.GetValue() {
+		t.Errorf("expected %v, but received %v", e.GetValue(), p)
+	}
+
+	if _, err := Proto.Marshal(entity{}); err == nil {
+		t.Errorf("expected an error for a value which is not a proto.Message")
+	}
+}
+
+func TestByContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		expected    Codec
+	}{
+		{contentType: "application/json", expected: JSON},
+		{contentType: "application/x-protobuf", expected: Proto},
+		{contentType: "text/plain", expected: nil},
+	}
+
+	for _, c := range cases {
+		if a := ByContentType(c.contentType); a != c.expected {
+			t.Errorf("expected %v, but received %v", c.expected, a)
+		}
+	}
+}
@@ -3,6 +3,9 @@ package constant
 const (
 	RegionEnvName      = "REGION"
 	EnvironmentEnvName = "APP_CONFIG_ENV"
+
+	RabbitMQURLEnvName    = "RABBITMQ_URL"
+	RabbitMQSecretEnvName = "RABBITMQ_SECRET_ID"
 )
 
 const (
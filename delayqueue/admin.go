@@ -0,0 +1,165 @@
+package delayQueue
+
+import (
+	"context"
+	"errors"
+	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Stats are the numbers of the queues of a RabbitMQDelayQueue. The messages which are still delayed in the
+// levels shared by all the DelayQueues, or in the exchange of the x-delayed-message plugin, are not counted.
+type Stats struct {
+	// ProducerMessages is the number of the messages waiting in the producer queue,
+	// which only has those published before the delay levels
+	ProducerMessages int
+	// ConsumerMessages is the number of the due messages waiting for a consumer
+	ConsumerMessages int
+	// Consumers is the number of the consumers of the consumer queue, in all the processes
+	Consumers int
+	// RetryMessages is the number of the failed messages waiting for their next attempt, in the retry queues
+	// of the backoffs of WithRetry
+	RetryMessages int
+	// DeadLetters is the number of the messages in the dead letter queue
+	DeadLetters int
+}
+
+// Stats returns the numbers of the queues of d, a queue which does not exist counts as empty.
+func (d *RabbitMQDelayQueue) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	for _, q := range d.allQueues() {
+		queue, err := inspectQueue(ctx, q)
+		if err != nil {
+			return Stats{}, err
+		}
+		switch q.name {
+		case d.getQueueNameForProducer():
+			stats.ProducerMessages = queue.Messages
+		case d.getQueueNameForConsumer():
+			stats.ConsumerMessages = queue.Messages
+			stats.Consumers = queue.Consumers
+		case d.getQueueNameForDeadLetter():
+			stats.DeadLetters = queue.Messages
+		default:
+			stats.RetryMessages += queue.Messages
+		}
+	}
+	return stats, nil
+}
+
+// Purge removes the messages waiting in the producer queue, the consumer queue and the retry queues of d
+// and returns their number. The dead letters are kept, see PurgeDeadLetters, so are the messages which are
+// still delayed, see Stats.
+func (d *RabbitMQDelayQueue) Purge(ctx context.Context) (int, error) {
+	var total int
+	for _, q := range append([]queueRef{d.producerQueue(), d.consumerQueue()}, d.retryQueues()...) {
+		var count int
+		err := q.conn.WithChannel(ctx, func(ch *amqp.Channel) error {
+			var err error
+			count, err = ch.QueuePurge(q.name, false)
+			return err
+		})
+		if err != nil && !isNotFound(err) {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// Delete closes d, see Close, then deletes its queues, including the dead letter queue, and its exchanges.
+// It returns the number of the messages deleted with the queues. The DelayQueue of the same name can be
+// created again afterwards.
+func (d *RabbitMQDelayQueue) Delete(ctx context.Context) (int, error) {
+	err := d.Close(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	// 先删除队列，再删除 exchange，删除时一并忘掉它们，重连后不会再次声明
+	for _, q := range d.allQueues() {
+		count, err := q.conn.DeleteQueue(q.name)
+		if err != nil && !isNotFound(err) {
+			return total, err
+		}
+		total += count
+	}
+
+	for _, exchange := range []string{d.getExchange(), d.getDelayedExchange()} {
+		err := d.producer.DeleteExchange(exchange)
+		if err != nil && !isNotFound(err) {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// DetailedStats returns the queues of d from the management API of the broker, e.g. with the unacknowledged
+// messages and the rates, keyed by their names. The queues which do not exist are left out.
+func (d *RabbitMQDelayQueue) DetailedStats(ctx context.Context, m *rabbitMQ.ManagementClient) (map[string]rabbitMQ.QueueInfo, error) {
+	queues := make(map[string]rabbitMQ.QueueInfo)
+	for _, q := range d.allQueues() {
+		queue, err := m.Queue(ctx, q.name)
+		var managementErr *rabbitMQ.ManagementError
+		if errors.As(err, &managementErr) && managementErr.NotFound() {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		queues[q.name] = queue
+	}
+	return queues, nil
+}
+
+// queueRef is a queue of a RabbitMQDelayQueue with the connection which declared it.
+type queueRef struct {
+	conn *rabbitMQ.Connection
+	name string
+}
+
+func (d *RabbitMQDelayQueue) producerQueue() queueRef {
+	return queueRef{conn: d.producer, name: d.getQueueNameForProducer()}
+}
+
+func (d *RabbitMQDelayQueue) consumerQueue() queueRef {
+	return queueRef{conn: d.consumer, name: d.getQueueNameForConsumer()}
+}
+
+// retryQueues are declared by the consumers, with the backoffs of WithRetry.
+func (d *RabbitMQDelayQueue) retryQueues() []queueRef {
+	var queues []queueRef
+	for _, name := range d.getQueueNamesForRetry() {
+		queues = append(queues, queueRef{conn: d.consumer, name: name})
+	}
+	return queues
+}
+
+func (d *RabbitMQDelayQueue) deadLetterQueue() queueRef {
+	return queueRef{conn: d.consumer, name: d.getQueueNameForDeadLetter()}
+}
+
+func (d *RabbitMQDelayQueue) allQueues() []queueRef {
+	queues := append([]queueRef{d.producerQueue(), d.consumerQueue()}, d.retryQueues()...)
+	return append(queues, d.deadLetterQueue())
+}
+
+// inspectQueue declares the queue passively, the queue is empty if it does not exist.
+func inspectQueue(ctx context.Context, q queueRef) (amqp.Queue, error) {
+	var queue amqp.Queue
+	err := q.conn.WithChannel(ctx, func(ch *amqp.Channel) error {
+		var err error
+		queue, err = ch.QueueDeclarePassive(q.name, true, false, false, false, nil)
+		return err
+	})
+	if isNotFound(err) {
+		return amqp.Queue{Name: q.name}, nil
+	}
+	return queue, err
+}
+
+func isNotFound(err error) bool {
+	var amqpErr *amqp.Error
+	return errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound
+}
@@ -0,0 +1,102 @@
+package delayQueue
+
+import (
+	"context"
+	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRabbitMQDelayQueue_Admin(t *testing.T) {
+	d := newRabbitMQQueue(t).(*RabbitMQDelayQueue)
+	ctx := context.TODO()
+
+	for i := 0; i < 2; i++ {
+		_, err := d.PublishAfter(ctx, 0, Message{Body: []byte("due")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats Stats
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		var err error
+		stats, err = d.Stats(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.ConsumerMessages == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	if e, a := (Stats{ConsumerMessages: 2}), stats; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	count, err := d.Purge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 2, count; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	_, err = d.Delete(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.PublishAfter(ctx, 0, Message{}); err != ErrClosed {
+		t.Errorf("expected %v, but received %v", ErrClosed, err)
+	}
+	// the deleted queues count as empty
+	stats, err = d.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := (Stats{}), stats; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestRabbitMQDelayQueue_DetailedStats(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.EscapedPath(), "/api/queues/%2F/")
+		switch name {
+		case "admin_consumer":
+			_, _ = w.Write([]byte(`{"name":"admin_consumer","messages":3,"messages_unacknowledged":1,"consumers":2}`))
+		case "admin_dlq":
+			_, _ = w.Write([]byte(`{"name":"admin_dlq","messages":1}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	d := &RabbitMQDelayQueue{name: "admin"}
+	queues, err := d.DetailedStats(context.TODO(), rabbitMQ.NewManagementClient(s.URL, "guest", "guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := map[string]rabbitMQ.QueueInfo{
+		"admin_consumer": {Name: "admin_consumer", Messages: 3, MessagesUnacknowledged: 1, Consumers: 2},
+		"admin_dlq":      {Name: "admin_dlq", Messages: 1},
+	}
+	if len(e) != len(queues) {
+		t.Errorf("expected %v, but received %v", e, queues)
+	}
+	for name, queue := range e {
+		if a := queues[name]; queue != a {
+			t.Errorf("expected %v, but received %v", queue, a)
+		}
+	}
+
+	s.Close()
+	if _, err := d.DetailedStats(context.TODO(), rabbitMQ.NewManagementClient(s.URL, "guest", "guest")); err == nil {
+		t.Errorf("expected an error once the management api is down")
+	}
+}
@@ -0,0 +1,137 @@
+package delayQueue
+
+import (
+	"context"
+	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"time"
+)
+
+// DeadLetter is a message which failed at its last attempt.
+type DeadLetter struct {
+	MessageId   string
+	ContentType string
+	Body        []byte
+	Headers     amqp.Table
+	// Error is the error of the last attempt
+	Error    string
+	Attempts int
+	// Timestamp is the time when the message was published
+	Timestamp time.Time
+	FailedAt  time.Time
+}
+
+func newDeadLetter(d amqp.Delivery) DeadLetter {
+	deadLetter := DeadLetter{
+		MessageId:   d.MessageId,
+		ContentType: d.ContentType,
+		Body:        d.Body,
+		Headers:     d.Headers,
+		Attempts:    rabbitMQ.Attempts(d),
+		Timestamp:   d.Timestamp,
+	}
+	deadLetter.Error, _ = d.Headers[rabbitMQ.ErrorHeader].(string)
+	deadLetter.FailedAt, _ = d.Headers[rabbitMQ.FailedAtHeader].(time.Time)
+	return deadLetter
+}
+
+// DeadLetterCount returns the number of the messages in the dead letter queue.
+func (d *RabbitMQDelayQueue) DeadLetterCount(ctx context.Context) (int, error) {
+	var count int
+	err := d.producer.WithChannel(ctx, func(ch *amqp.Channel) error {
+		q, err := ch.QueueInspect(d.getQueueNameForDeadLetter())
+		count = q.Messages
+		return err
+	})
+	return count, err
+}
+
+// PeekDeadLetters returns the first limit messages of the dead letter queue and leaves them there,
+// a limit less than 1 returns all the messages.
+func (d *RabbitMQDelayQueue) PeekDeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	var deadLetters []DeadLetter
+	err := d.getDeadLetters(ctx, limit, func(delivery amqp.Delivery) error {
+		deadLetters = append(deadLetters, newDeadLetter(delivery))
+		return nil
+	})
+	return deadLetters, err
+}
+
+// PurgeDeadLetters removes all the messages of the dead letter queue and returns their number.
+func (d *RabbitMQDelayQueue) PurgeDeadLetters(ctx context.Context) (int, error) {
+	var count int
+	err := d.producer.WithChannel(ctx, func(ch *amqp.Channel) error {
+		var err error
+		count, err = ch.QueuePurge(d.getQueueNameForDeadLetter(), false)
+		return err
+	})
+	return count, err
+}
+
+// ReplayDeadLetters publishes the first limit messages of the dead letter queue to the DelayQueue again
+// with delay, their attempts start over. A limit less than 1 replays all the messages, it returns the
+// number of the messages replayed.
+func (d *RabbitMQDelayQueue) ReplayDeadLetters(ctx context.Context, limit int, delay time.Duration) (int, error) {
+	var count int
+	err := d.getDeadLetters(ctx, limit, func(delivery amqp.Delivery) error {
+		msg := rabbitMQ.Republishing(delivery, nil)
+		for _, header := range []string{
+			rabbitMQ.AttemptsHeader,
+			rabbitMQ.ErrorHeader,
+			rabbitMQ.QueueHeader,
+			rabbitMQ.FailedAtHeader,
+		} {
+			delete(msg.Headers, header)
+		}
+
+		err := d.publishAt(ctx, msg, time.Now().Add(delay))
+		if err != nil {
+			return err
+		}
+		err = delivery.Ack(false)
+		if err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// getDeadLetters gets the first limit messages of the dead letter queue on a channel of its own, the messages
+// which are not acknowledged by fn are put back in the queue once the channel is closed.
+func (d *RabbitMQDelayQueue) getDeadLetters(ctx context.Context, limit int, fn func(delivery amqp.Delivery) error) error {
+	ch, err := d.producer.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	// 只处理当前已有的消息，重放后再次失败的消息不会被重复处理
+	q, err := ch.QueueInspect(d.getQueueNameForDeadLetter())
+	if err != nil {
+		return err
+	}
+	if limit < 1 || limit > q.Messages {
+		limit = q.Messages
+	}
+
+	for i := 0; i < limit; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		delivery, ok, err := ch.Get(q.Name, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		err = fn(delivery)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
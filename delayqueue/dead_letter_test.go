@@ -0,0 +1,121 @@
+package delayQueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewDeadLetter(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	failedAt := timestamp.Add(time.Minute)
+	deadLetter := newDeadLetter(amqp.Delivery{
+		MessageId: "id",
+		Timestamp: timestamp,
+		Body:      []byte("body"),
+		Headers: amqp.Table{
+			rabbitMQ.AttemptsHeader: int32(3),
+			rabbitMQ.ErrorHeader:    "failure",
+			rabbitMQ.FailedAtHeader: failedAt,
+		},
+	})
+
+	if e, a := "id", deadLetter.MessageId; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := 3, deadLetter.Attempts; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := "failure", deadLetter.Error; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := timestamp, deadLetter.Timestamp; !e.Equal(a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := failedAt, deadLetter.FailedAt; !e.Equal(a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestDelayQueue_DeadLetters(t *testing.T) {
+	d := newTestRabbitMQ(t, fmt.Sprintf("sdk_go_test_dead_letter_%d", time.Now().UnixNano()))
+
+	var fail int32 = 1
+	handled := make(chan string, 10)
+	err := d.Consume(func(ctx context.Context, delivery Delivery) error {
+		if atomic.LoadInt32(&fail) == 1 {
+			return errors.New("failure")
+		}
+		handled <- string(delivery.Body)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	for _, body := range []string{"x", "y"} {
+		err = d.Publish(context.TODO(), "text/plain", body, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; ; i++ {
+		count, err := d.DeadLetterCount(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count == 2 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("expected %v, but received %v", 2, count)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	// peek leaves the dead letters in the queue
+	for i := 0; i < 2; i++ {
+		deadLetters, err := d.PeekDeadLetters(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, a := 1, len(deadLetters); e != a {
+			t.Fatalf("expected %v, but received %v", e, a)
+		}
+		if e, a := "failure", deadLetters[0].Error; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if deadLetters[0].Timestamp.IsZero() {
+			t.Errorf("expected the original timestamp")
+		}
+	}
+
+	atomic.StoreInt32(&fail, 0)
+	count, err := d.ReplayDeadLetters(ctx, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 1, count; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	select {
+	case <-handled:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the replayed message")
+	}
+
+	count, err = d.PurgeDeadLetters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 1, count; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
@@ -0,0 +1,203 @@
+package delayQueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hxy1991/sdk-go/cache"
+	"github.com/hxy1991/sdk-go/log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultDedupLease is how long a message is marked as being handled unless it is renewed, it can be
+	// handled again afterwards if the consumer did not finish it, e.g. because the process exited
+	defaultDedupLease = time.Minute * 5
+
+	dedupHandling = "handling"
+	dedupHandled  = "handled"
+)
+
+// ErrDuplicateInProgress is the error of a message which is being handled by another consumer, the message
+// is delivered again once the lease of that consumer expires, without counting an attempt.
+var ErrDuplicateInProgress = errors.New("delayQueue message is being handled")
+
+// DedupStore keeps the ids of the handled messages, cache.LocalBackend and redis.Client implement it.
+// It must be shared by all the consumers of the DelayQueue, so the LocalBackend only suits a single instance.
+type DedupStore interface {
+	cache.Backend
+	// SetNX sets key only if it does not exist and returns whether it did
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+}
+
+// Deduplicator passes a message to the handler at most once within its window by the id of the message,
+// the duplicates are acknowledged without calling the handler. A message is only marked as handled once
+// the handler returns nil, so the failed ones are retried.
+type Deduplicator struct {
+	store  DedupStore
+	window time.Duration
+	// leaseTTL is renewed while the handler runs, see WithDedupLease
+	leaseTTL time.Duration
+
+	handled     int64
+	duplicates  int64
+	inProgress  int64
+	storeErrors int64
+}
+
+// DedupStats is a snapshot of the counters of a Deduplicator, the counters only ever increase.
+type DedupStats struct {
+	// Handled is the number of the messages marked as handled
+	Handled int64
+	// Duplicates is the number of the dropped messages which were handled already
+	Duplicates int64
+	// InProgress is the number of the messages failed with ErrDuplicateInProgress
+	InProgress int64
+	// StoreErrors is the number of the failed calls to the store
+	StoreErrors int64
+}
+
+// DedupOption configures a Deduplicator.
+type DedupOption interface {
+	apply(*Deduplicator)
+}
+
+type dedupOptionFunc func(*Deduplicator)
+
+func (f dedupOptionFunc) apply(d *Deduplicator) {
+	f(d)
+}
+
+// WithDedupLease is how long a message is marked as being handled, the default is 5m. The mark is renewed
+// every third of lease while the handler runs, so a shorter lease only shortens the wait after a crash.
+func WithDedupLease(lease time.Duration) DedupOption {
+	return dedupOptionFunc(func(d *Deduplicator) {
+		if lease > 0 {
+			d.leaseTTL = lease
+		}
+	})
+}
+
+// NewDeduplicator remembers the handled messages in store for window, which should be longer than the
+// redeliveries are expected, e.g. the retries of the messages.
+func NewDeduplicator(store DedupStore, window time.Duration, opts ...DedupOption) *Deduplicator {
+	d := &Deduplicator{store: store, window: window, leaseTTL: defaultDedupLease}
+	for _, opt := range opts {
+		opt.apply(d)
+	}
+	return d
+}
+
+// Stats returns the counters of d, e.g. to report them as metrics.
+func (d *Deduplicator) Stats() DedupStats {
+	return DedupStats{
+		Handled:     atomic.LoadInt64(&d.handled),
+		Duplicates:  atomic.LoadInt64(&d.duplicates),
+		InProgress:  atomic.LoadInt64(&d.inProgress),
+		StoreErrors: atomic.LoadInt64(&d.storeErrors),
+	}
+}
+
+// wrap deduplicates the messages of the DelayQueue of name before next, the messages without an id are
+// passed to next as they are.
+func (d *Deduplicator) wrap(name string, next Handler) Handler {
+	return func(ctx context.Context, delivery Delivery) error {
+		if delivery.Id == "" {
+			return next(ctx, delivery)
+		}
+
+		key := getDedupKey(name, delivery.Id)
+		ok, err := d.store.SetNX(ctx, key, []byte(dedupHandling), d.lease())
+		if err != nil {
+			atomic.AddInt64(&d.storeErrors, 1)
+			return fmt.Errorf("mark message as handling: %w", err)
+		}
+		if !ok {
+			return d.duplicate(ctx, name, key, delivery)
+		}
+
+		stop := d.renew(ctx, name, key, delivery.Id)
+		err = callHandler(ctx, next, delivery)
+		stop()
+		if err != nil {
+			// 失败的消息可以重试
+			if deleteErr := d.store.Delete(ctx, key); deleteErr != nil {
+				atomic.AddInt64(&d.storeErrors, 1)
+				log.Context(ctx).With("queueName", name, "messageId", delivery.Id).Error("unmark message error ", deleteErr)
+			}
+			return err
+		}
+
+		atomic.AddInt64(&d.handled, 1)
+		err = d.store.Set(ctx, key, []byte(dedupHandled), d.window)
+		if err != nil {
+			// the message is handled, it is only deduplicated until the end of the lease
+			atomic.AddInt64(&d.storeErrors, 1)
+			log.Context(ctx).With("queueName", name, "messageId", delivery.Id).Error("mark message as handled error ", err)
+		}
+		return nil
+	}
+}
+
+// lease is how long a message is marked as being handled.
+func (d *Deduplicator) lease() time.Duration {
+	if d.window < d.leaseTTL {
+		return d.window
+	}
+	return d.leaseTTL
+}
+
+// renew extends the mark of key until stop is called, stop returns once the mark is not renewed any more.
+func (d *Deduplicator) renew(ctx context.Context, name, key, id string) (stop func()) {
+	lease := d.lease()
+	if lease/3 <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := d.store.Set(ctx, key, []byte(dedupHandling), lease)
+				if err != nil {
+					atomic.AddInt64(&d.storeErrors, 1)
+					log.Context(ctx).With("queueName", name, "messageId", id).Error("renew message lease error ", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (d *Deduplicator) duplicate(ctx context.Context, name, key string, delivery Delivery) error {
+	value, found, err := d.store.Get(ctx, key)
+	if err != nil {
+		atomic.AddInt64(&d.storeErrors, 1)
+		return fmt.Errorf("check duplicate message: %w", err)
+	}
+
+	logger := log.Context(ctx).With("queueName", name, "messageId", delivery.Id, "attempt", delivery.Attempt)
+	if found && string(value) == dedupHandled {
+		atomic.AddInt64(&d.duplicates, 1)
+		logger.Info("drop duplicate message")
+		return nil
+	}
+	// being handled, or the mark expired in the meantime
+	atomic.AddInt64(&d.inProgress, 1)
+	logger.Warn("duplicate message is being handled")
+	return ErrDuplicateInProgress
+}
+
+func getDedupKey(name, id string) string {
+	return "delayQueue:" + name + ":handled:" + id
+}
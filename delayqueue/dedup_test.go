@@ -0,0 +1,206 @@
+package delayQueue
+
+import (
+	"context"
+	"errors"
+	"github.com/hxy1991/sdk-go/cache"
+	"github.com/hxy1991/sdk-go/cache/redis"
+	"github.com/hxy1991/sdk-go/cache/redis/redistest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.New(s.Addr)
+	defer client.Close()
+
+	for name, store := range map[string]DedupStore{
+		"local": cache.NewLocalBackend(100),
+		"redis": client,
+	} {
+		t.Run(name, func(t *testing.T) {
+			testDeduplicator(t, store)
+		})
+	}
+}
+
+func testDeduplicator(t *testing.T, store DedupStore) {
+	ctx := context.TODO()
+	dedup := NewDeduplicator(store, time.Minute)
+
+	var calls int
+	fail := errors.New("failure")
+	var result error
+	handler := dedup.wrap("dedup", func(ctx context.Context, delivery Delivery) error {
+		calls++
+		return result
+	})
+
+	delivery := Delivery{Id: newMessageId(time.Now())}
+	cases := []struct {
+		result        error
+		expectedErr   error
+		expectedCalls int
+	}{
+		// a failed message is not marked as handled
+		{result: fail, expectedErr: fail, expectedCalls: 1},
+		{result: nil, expectedErr: nil, expectedCalls: 2},
+		// duplicate
+		{result: nil, expectedErr: nil, expectedCalls: 2},
+		{result: fail, expectedErr: nil, expectedCalls: 2},
+	}
+	for i, c := range cases {
+		result = c.result
+		if e, a := c.expectedErr, handler(ctx, delivery); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		if e, a := c.expectedCalls, calls; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+
+	// being handled by another consumer
+	handling := Delivery{Id: newMessageId(time.Now())}
+	_, err := store.SetNX(ctx, getDedupKey("dedup", handling.Id), []byte(dedupHandling), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := ErrDuplicateInProgress, handler(ctx, handling); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	// without an id
+	result = nil
+	err = handler(ctx, Delivery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 3, calls; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	e := DedupStats{Handled: 1, Duplicates: 2, InProgress: 1}
+	if a := dedup.Stats(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+// TestDeduplicator_Renew redelivers a message while its handler outlives the lease.
+func TestDeduplicator_Renew(t *testing.T) {
+	ctx := context.TODO()
+	lease := time.Millisecond * 100
+	dedup := NewDeduplicator(cache.NewLocalBackend(100), time.Minute, WithDedupLease(lease))
+
+	var calls int32
+	handler := dedup.wrap("dedup", func(ctx context.Context, delivery Delivery) error {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(lease * 4)
+		return nil
+	})
+
+	delivery := Delivery{Id: newMessageId(time.Now())}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- handler(ctx, delivery)
+	}()
+
+	time.Sleep(lease * 2)
+	if e, a := ErrDuplicateInProgress, handler(ctx, delivery); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if e, a := int32(1), atomic.LoadInt32(&calls); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	// handled
+	if e, a := error(nil), handler(ctx, delivery); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := int32(1), atomic.LoadInt32(&calls); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestMemoryDelayQueue_Deduplication(t *testing.T) {
+	dedup := NewDeduplicator(cache.NewLocalBackend(100), time.Minute)
+	q, err := NewMemory(testQueueName(), WithDeduplication(dedup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close(context.TODO())
+
+	deliveries := consume(t, q)
+	// a redelivery of the same message
+	delivery := Delivery{Id: newMessageId(time.Now()), Attempt: 1}
+	for i := 0; i < 2; i++ {
+		err = q.push(time.Now(), delivery)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receive(t, deliveries)
+	select {
+	case <-deliveries:
+		t.Errorf("expected the duplicate to be dropped")
+	case <-time.After(time.Millisecond * 100):
+	}
+	if e, a := (DedupStats{Handled: 1, Duplicates: 1}), dedup.Stats(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	if _, err := NewMemory(testQueueName(), WithDeduplication(nil)); err == nil {
+		t.Errorf("expected an error for a nil deduplicator")
+	}
+}
+
+// TestDeduplication_InProgress delivers a message again once the lease of a crashed consumer expires,
+// without counting an attempt.
+func TestDeduplication_InProgress(t *testing.T) {
+	for name, newQueue := range map[string]func(t *testing.T, opts ...Option) DelayQueue{
+		"memory": newMemoryQueue,
+		"redis":  newRedisQueue,
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := cache.NewLocalBackend(100)
+			window := time.Millisecond * 300
+			q := newQueue(t, WithDeduplication(NewDeduplicator(store, window)))
+			deliveries := consume(t, q)
+
+			var queueName string
+			switch q := q.(type) {
+			case *MemoryDelayQueue:
+				queueName = q.name
+			case *RedisDelayQueue:
+				queueName = q.name
+			}
+
+			ctx := context.TODO()
+			id, err := q.PublishAfter(ctx, time.Millisecond*200, Message{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the mark of a consumer which crashed
+			_, err = store.SetNX(ctx, getDedupKey(queueName, id), []byte(dedupHandling), window)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			delivery := receive(t, deliveries)
+			if e, a := id, delivery.Id; e != a {
+				t.Errorf("expected %v, but received %v", e, a)
+			}
+			if e, a := 1, delivery.Attempt; e != a {
+				t.Errorf("expected %v, but received %v", e, a)
+			}
+		})
+	}
+}
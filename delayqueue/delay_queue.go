@@ -1,58 +1,91 @@
 package delayQueue
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/hxy1991/sdk-go/log"
 	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
 	amqp "github.com/rabbitmq/amqp091-go"
-	"strconv"
 	"sync"
 	"time"
 )
 
-var initConnection sync.Once
+var (
+	// connMu guards the shared connections of all the RabbitMQDelayQueues and the open ones
+	connMu       sync.Mutex
+	producerConn *rabbitMQ.Connection
+	consumerConn *rabbitMQ.Connection
+	openQueues   = map[*RabbitMQDelayQueue]struct{}{}
+)
 
-var producerConn *rabbitMQ.Connection
-var consumerConn *rabbitMQ.Connection
+// RabbitMQDelayQueue is the DelayQueue of the broker of the RABBITMQ_URL env, see the rabbitMQ package.
+type RabbitMQDelayQueue struct {
+	name      string
+	scheduler scheduler
+	cfg       config
+	// producer and consumer are the shared connections when the DelayQueue was created
+	producer *rabbitMQ.Connection
+	consumer *rabbitMQ.Connection
+
+	// readOnly is set by Open, the topology of d is not declared and d has no scheduler
+	readOnly bool
+
+	mu        sync.Mutex
+	closed    bool
+	consumers []*rabbitMQ.Consumer
+}
 
-type DelayQueue struct {
-	name string
+func New(name string) (*RabbitMQDelayQueue, error) {
+	return NewWithOptions(name)
 }
 
-func New(name string) (*DelayQueue, error) {
-	initConnection.Do(func() {
-		_producerConn, err := rabbitMQ.New()
+// connect opens the shared connections unless they are open, a failure is retried by the next call.
+func connect() (*rabbitMQ.Connection, *rabbitMQ.Connection, error) {
+	connMu.Lock()
+	defer connMu.Unlock()
+
+	if producerConn == nil {
+		conn, err := rabbitMQ.New()
 		if err != nil {
-			log.Error(err)
-			return
+			return nil, nil, fmt.Errorf("init producer connection fail: %w", err)
 		}
-		producerConn = _producerConn
+		producerConn = conn
 
 		log.With().Info("init shared producer connection of all delayQueues successfully")
+	}
 
-		_consumerConn, err := rabbitMQ.New()
+	if consumerConn == nil {
+		conn, err := rabbitMQ.New()
 		if err != nil {
-			log.With().Error(err)
-			return
+			return nil, nil, fmt.Errorf("init consumer connection fail: %w", err)
 		}
-		consumerConn = _consumerConn
+		consumerConn = conn
 
 		log.With().Info("init shared consumer connection of all delayQueues successfully")
-	})
+	}
+	return producerConn, consumerConn, nil
+}
 
-	if producerConn == nil {
-		return nil, fmt.Errorf("init producer connection fail")
+func NewWithOptions(name string, opts ...Option) (*RabbitMQDelayQueue, error) {
+	producer, consumer, err := connect()
+	if err != nil {
+		return nil, err
 	}
 
-	if consumerConn == nil {
-		return nil, fmt.Errorf("init consumer connection fail")
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	d := &DelayQueue{
-		name: name,
+	d := &RabbitMQDelayQueue{
+		name:     name,
+		cfg:      cfg,
+		producer: producer,
+		consumer: consumer,
 	}
 
-	err := d.exchangeDeclare()
+	err = d.exchangeDeclare()
 	if err != nil {
 		return nil, err
 	}
@@ -67,126 +100,259 @@ func New(name string) (*DelayQueue, error) {
 		return nil, err
 	}
 
-	return d, nil
-}
-
-func (d DelayQueue) exchangeDeclare() error {
-	ch, err := producerConn.Channel()
+	err = d.deadLetterQueueDeclare()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer d.closeChannel(ch)
 
-	err = rabbitMQ.ExchangeDeclareDefault(ch, d.getExchange())
+	d.scheduler, err = newScheduler(d)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	connMu.Lock()
+	openQueues[d] = struct{}{}
+	connMu.Unlock()
+	return d, nil
 }
 
-func (d DelayQueue) producerQueueDeclare() error {
-	ch, err := producerConn.Channel()
+// Open returns the RabbitMQDelayQueue of name to inspect it, e.g. Stats and the dead letters, without
+// declaring anything on the broker. It fails if the consumer queue of name does not exist. Publishing and
+// consuming return ErrReadOnly, see New.
+func Open(name string, opts ...Option) (*RabbitMQDelayQueue, error) {
+	producer, consumer, err := connect()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer d.closeChannel(ch)
 
-	_, err = rabbitMQ.QueueDeclareDefault(ch, d.getQueueNameForProducer(), d.getExchange())
+	cfg, err := newConfig(opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
-}
 
-func (d DelayQueue) consumerQueueDeclare() error {
-	ch, err := consumerConn.Channel()
-	if err != nil {
-		return err
+	d := &RabbitMQDelayQueue{
+		name:     name,
+		cfg:      cfg,
+		producer: producer,
+		consumer: consumer,
+		readOnly: true,
 	}
-	defer d.closeChannel(ch)
 
-	q, err := rabbitMQ.QueueDeclareDefault(ch, d.getQueueNameForConsumer(), "")
-	if err != nil {
+	err = consumer.WithChannel(context.Background(), func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclarePassive(d.getQueueNameForConsumer(), true, false, false, false, nil)
 		return err
+	})
+	if isNotFound(err) {
+		return nil, fmt.Errorf("delayQueue %s does not exist", name)
 	}
-
-	err = rabbitMQ.QueueBindDefault(ch, q.Name, d.getExchange())
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return d, nil
 }
 
-func (d DelayQueue) Publish(contentType, body string, delayInMilli int) error {
-	ch, err := producerConn.Channel()
-	if err != nil {
-		return err
+// Close leaves the shared connections open, see Shutdown.
+func (d *RabbitMQDelayQueue) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
 	}
-	defer d.closeChannel(ch)
-
-	// RabbitMQ默认提供了一个Exchange，名字是空字符串，类型是Direct，绑定到所有的Queue。 每一个Queue和这个无名Exchange之间的Binding Key是Queue的名字。
-	return ch.Publish(
-		"",
-		d.getQueueNameForProducer(),
-		false,
-		false,
-		amqp.Publishing{
-			// 持久化消息
-			DeliveryMode: 2,
-			ContentType:  contentType,
-			Body:         []byte(body),
-			Expiration:   strconv.Itoa(delayInMilli),
-			Timestamp:    time.Now(),
-		})
+	d.closed = true
+	consumers := d.consumers
+	d.consumers = nil
+	d.mu.Unlock()
+
+	connMu.Lock()
+	delete(openQueues, d)
+	connMu.Unlock()
+
+	var errs []error
+	for _, consumer := range consumers {
+		err := consumer.Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func (d DelayQueue) Consume(callback func(amqp.Delivery)) error {
-	ch, err := consumerConn.Channel()
-	if err != nil {
-		return err
+// Shutdown closes all the RabbitMQDelayQueues, then the shared consumer and producer connections.
+// The RabbitMQDelayQueues created afterwards open new connections.
+func Shutdown(ctx context.Context) error {
+	connMu.Lock()
+	queues := make([]*RabbitMQDelayQueue, 0, len(openQueues))
+	for d := range openQueues {
+		queues = append(queues, d)
+	}
+	producer, consumer := producerConn, consumerConn
+	producerConn, consumerConn = nil, nil
+	connMu.Unlock()
+
+	var errs []error
+	for _, d := range queues {
+		err := d.Close(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("close delayQueue %s: %w", d.name, err))
+		}
 	}
 
-	name := d.getQueueNameForConsumer()
-	delivery, err := rabbitMQ.ConsumeDefault(ch, name)
+	// 消费者重试和死信的消息通过 consumer 连接发布，所以先关闭它
+	if consumer != nil {
+		err := consumer.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if producer != nil {
+		err := producer.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// exchangeDeclare and the queue declarations go through the connections,
+// so that they are declared again after reconnecting.
+func (d *RabbitMQDelayQueue) exchangeDeclare() error {
+	return d.producer.DeclareExchange(rabbitMQ.Exchange{
+		Name:    d.getExchange(),
+		Kind:    "fanout",
+		Durable: true,
+	})
+}
+
+// producerQueueDeclare declares the queue where the messages used to wait for their expiration,
+// so that those published before the delay levels are still delivered.
+func (d *RabbitMQDelayQueue) producerQueueDeclare() error {
+	_, err := d.producer.DeclareQueue(rabbitMQ.Queue{
+		Name:    d.getQueueNameForProducer(),
+		Durable: true,
+		Args: amqp.Table{
+			// 消息过期后转发到 exchange，再路由到 consumer 的队列
+			"x-dead-letter-exchange": d.getExchange(),
+		},
+	})
+	return err
+}
+
+func (d *RabbitMQDelayQueue) consumerQueueDeclare() error {
+	q, err := d.consumer.DeclareQueue(rabbitMQ.Queue{
+		Name:    d.getQueueNameForConsumer(),
+		Durable: true,
+	})
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		defer func() {
-			if e := recover(); e != nil {
-				log.With("queueName", name).Error(e)
-			}
-		}()
+	return d.consumer.BindQueue(rabbitMQ.Binding{
+		Queue:    q.Name,
+		Exchange: d.getExchange(),
+	})
+}
 
-		for d := range delivery {
-			callback(d)
-		}
-	}()
+func (d *RabbitMQDelayQueue) deadLetterQueueDeclare() error {
+	_, err := d.consumer.DeclareQueue(rabbitMQ.Queue{
+		Name:    d.getQueueNameForDeadLetter(),
+		Durable: true,
+	})
+	return err
+}
 
-	log.With("queueName", name).Info("consumer is waiting")
+// Publish delivers body to the consumers after delayInMilli, a message is never held up by the longer
+// delays of the messages published before it. PublishAfter and PublishAt return the id of the message,
+// which can be canceled.
+func (d *RabbitMQDelayQueue) Publish(ctx context.Context, contentType, body string, delayInMilli int) error {
+	_, err := d.PublishAfter(ctx, time.Duration(delayInMilli)*time.Millisecond, Message{
+		ContentType: contentType,
+		Body:        []byte(body),
+	})
+	return err
+}
 
+func (d *RabbitMQDelayQueue) publish(ctx context.Context, msg amqp.Publishing, delay time.Duration) error {
+	// 持久化消息
+	msg.DeliveryMode = amqp.Persistent
+	return d.scheduler.publish(ctx, msg, delay)
+}
+
+// Consume survives reconnections, the messages failed at their last attempt go to the dead letter queue.
+func (d *RabbitMQDelayQueue) Consume(handler Handler) error {
+	return d.ConsumeWithOptions(handler)
+}
+
+// ConsumeWithOptions is Consume with the options of the rabbitMQ consumer, which override WithRetry.
+func (d *RabbitMQDelayQueue) ConsumeWithOptions(handler Handler, opts ...rabbitMQ.ConsumerOption) error {
+	defaults := []rabbitMQ.ConsumerOption{rabbitMQ.WithDeadLetterQueue(d.getQueueNameForDeadLetter())}
+	if d.cfg.maxAttempts > 1 {
+		defaults = append(defaults, rabbitMQ.WithRetry(d.cfg.maxAttempts, d.cfg.minRetryBackoff, d.cfg.maxRetryBackoff))
+	}
+	if d.readOnly {
+		return ErrReadOnly
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+
+	consumer, err := rabbitMQ.NewConsumer(d.consumer, rabbitMQ.Queue{
+		Name:    d.getQueueNameForConsumer(),
+		Durable: true,
+	}, d.guard(d.adapt(d.cfg.handler(d.name, handler))), append(defaults, opts...)...)
+	if err != nil {
+		return err
+	}
+	err = consumer.Start()
+	if err != nil {
+		return err
+	}
+	d.consumers = append(d.consumers, consumer)
 	return nil
 }
 
-func (d DelayQueue) closeChannel(ch *amqp.Channel) {
-	func(ch *amqp.Channel) {
-		err := ch.Close()
-		if err != nil {
-			log.With().Error(err)
+// adapt passes the AMQP deliveries to handler.
+func (d *RabbitMQDelayQueue) adapt(handler Handler) rabbitMQ.Handler {
+	return func(ctx context.Context, delivery amqp.Delivery) error {
+		err := handleDelivery(ctx, d.name, handler, Delivery{
+			Id:          delivery.MessageId,
+			ContentType: delivery.ContentType,
+			Body:        delivery.Body,
+			Headers:     delivery.Headers,
+			Timestamp:   delivery.Timestamp,
+			Attempt:     rabbitMQ.Attempts(delivery),
+		})
+		if delay, ok := d.cfg.requeue(err); ok {
+			log.Context(ctx).With("queueName", d.name, "messageId", delivery.MessageId).Info("message is being handled, check it again after ", delay)
+			return d.publishAt(ctx, rabbitMQ.Republishing(delivery, nil), time.Now().Add(delay))
 		}
-	}(ch)
+		return err
+	}
 }
 
-func (d DelayQueue) getQueueNameForProducer() string {
+func (d *RabbitMQDelayQueue) getQueueNameForProducer() string {
 	return d.name + "_producer"
 }
 
-func (d DelayQueue) getQueueNameForConsumer() string {
+func (d *RabbitMQDelayQueue) getQueueNameForConsumer() string {
 	return d.name + "_consumer"
 }
 
-func (d DelayQueue) getExchange() string {
+func (d *RabbitMQDelayQueue) getQueueNameForDeadLetter() string {
+	return d.name + "_dlq"
+}
+
+// getQueueNamesForRetry are the queues where the failed messages wait for their next attempt, see WithRetry.
+func (d *RabbitMQDelayQueue) getQueueNamesForRetry() []string {
+	return rabbitMQ.RetryQueueNames(d.getQueueNameForConsumer(), d.cfg.maxAttempts, d.cfg.minRetryBackoff, d.cfg.maxRetryBackoff)
+}
+
+func (d *RabbitMQDelayQueue) getDelayedExchange() string {
+	return d.name + ".delayed"
+}
+
+func (d *RabbitMQDelayQueue) getExchange() string {
 	delayExChange := d.name + ".delay"
 	return delayExChange
 }
@@ -1,7 +1,8 @@
 package delayQueue
 
 import (
-	amqp "github.com/rabbitmq/amqp091-go"
+	"context"
+	"github.com/hxy1991/sdk-go/cache"
 	"testing"
 )
 
@@ -13,30 +14,114 @@ func TestDelayQueue(t *testing.T) {
 
 	delayInSecondX := 3
 	delayInMilliX := delayInSecondX * 1000
-	err = d.Publish("text/plain", "Hello world! I am x.", delayInMilliX)
+	err = d.Publish(context.TODO(), "text/plain", "Hello world! I am x.", delayInMilliX)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	delayInSecondY := 6
 	delayInMilliY := delayInSecondY * 1000
-	err = d.Publish("text/plain", "Hello world! I am y.", delayInMilliY)
+	err = d.Publish(context.TODO(), "text/plain", "Hello world! I am y.", delayInMilliY)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	forever := make(chan bool)
-	err = d.Consume(func(delivery amqp.Delivery) {
+	err = d.Consume(func(ctx context.Context, delivery Delivery) error {
 		t.Logf("consumer receive, body: %s, timestamp: %v", string(delivery.Body), delivery.Timestamp)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-forever
+}
+
+// newTestRabbitMQ skips the test if the broker can not be dialed, a failure to declare the DelayQueue
+// fails the test.
+func newTestRabbitMQ(t *testing.T, name string, opts ...Option) *RabbitMQDelayQueue {
+	_, _, err := connect()
+	if err != nil {
+		t.Skip("rabbitmq is not available: ", err)
+	}
+	d, err := NewWithOptions(name, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func newRabbitMQQueue(t *testing.T, opts ...Option) DelayQueue {
+	// the publishers and the consumers of the tests are in this process
+	tombstones := WithTombstoneStore(cache.NewLocalBackend(100))
+	d := newTestRabbitMQ(t, testQueueName(), append([]Option{tombstones}, opts...)...)
+	t.Cleanup(func() {
+		_ = d.Close(context.TODO())
+	})
+	return d
+}
+
+func TestRabbitMQDelayQueue(t *testing.T) {
+	testConformance(t, newRabbitMQQueue)
+}
+
+// TestShutdown connects again after a failure or a Shutdown.
+func TestShutdown(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		_, _, errConnect := connect()
+		if errConnect != nil {
+			if producerConn != nil || consumerConn != nil {
+				t.Errorf("expected no connection after a failure")
+			}
+			continue
+		}
 
-		err := delivery.Ack(false)
+		d, err := New(testQueueName())
 		if err != nil {
-			t.Error(err)
-			return
+			t.Fatal(err)
 		}
-	})
+		err = d.Consume(func(ctx context.Context, delivery Delivery) error {
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Shutdown(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.PublishAfter(context.TODO(), 0, Message{}); err != ErrClosed {
+			t.Errorf("expected %v, but received %v", ErrClosed, err)
+		}
+		if producerConn != nil || consumerConn != nil {
+			t.Errorf("expected the connections to be closed")
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	name := testQueueName()
+	_, _, err := connect()
+	if err != nil {
+		t.Skip("rabbitmq is not available: ", err)
+	}
+
+	if _, err := Open(name); err == nil {
+		t.Errorf("expected an error for a queue which does not exist")
+	}
+
+	newTestRabbitMQ(t, name)
+	d, err := Open(name)
 	if err != nil {
 		t.Fatal(err)
 	}
-	<-forever
+	if _, err := d.PublishAfter(context.TODO(), 0, Message{}); err != ErrReadOnly {
+		t.Errorf("expected %v, but received %v", ErrReadOnly, err)
+	}
+	if e, a := ErrReadOnly, d.Consume(func(ctx context.Context, delivery Delivery) error {
+		return nil
+	}); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
 }
@@ -0,0 +1,277 @@
+package delayQueue
+
+import (
+	"container/heap"
+	"context"
+	"github.com/hxy1991/sdk-go/log"
+	"sync"
+	"time"
+)
+
+// MemoryDelayQueue keeps the messages in the memory of the process, they are lost when it exits.
+// It suits the unit tests and the jobs of a single instance.
+type MemoryDelayQueue struct {
+	name string
+	cfg  config
+
+	mu    sync.Mutex
+	items memoryItems
+	byId  map[string]*memoryItem
+	seq   uint64
+	// wake is closed and replaced once the items change
+	wake    chan struct{}
+	closed  bool
+	stop    chan struct{}
+	workers sync.WaitGroup
+	// handlerCtx is the context of the handlers, it is canceled once Close gives up waiting for them
+	handlerCtx   context.Context
+	stopHandlers context.CancelFunc
+}
+
+type memoryItem struct {
+	at time.Time
+	// seq keeps the order of publishing between the messages due at the same time
+	seq      uint64
+	delivery Delivery
+	index    int
+}
+
+// memoryItems is a heap of the items by the time when they are due.
+type memoryItems []*memoryItem
+
+func (h memoryItems) Len() int {
+	return len(h)
+}
+
+func (h memoryItems) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h memoryItems) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *memoryItems) Push(x interface{}) {
+	item := x.(*memoryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *memoryItems) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// NewMemory returns a MemoryDelayQueue, its tombstones are in the memory of the process as well by default.
+func NewMemory(name string, opts ...Option) (*MemoryDelayQueue, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.tombstones == nil {
+		cfg.tombstones = defaultTombstones()
+	}
+
+	q := &MemoryDelayQueue{
+		name: name,
+		cfg:  cfg,
+		byId: map[string]*memoryItem{},
+		wake: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	q.handlerCtx, q.stopHandlers = context.WithCancel(context.Background())
+	return q, nil
+}
+
+func (q *MemoryDelayQueue) PublishAfter(ctx context.Context, delay time.Duration, msg Message) (string, error) {
+	return q.PublishAt(ctx, time.Now().Add(delay), msg)
+}
+
+func (q *MemoryDelayQueue) PublishAt(ctx context.Context, at time.Time, msg Message) (string, error) {
+	id := newMessageId(at)
+	err := q.push(at, Delivery{
+		Id:          id,
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+		Headers:     withContext(ctx, msg.Headers),
+		Timestamp:   time.Now(),
+		Attempt:     1,
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (q *MemoryDelayQueue) Cancel(ctx context.Context, id string) error {
+	// the tombstone cancels the retries of a message being handled as well
+	err := setTombstone(ctx, q.cfg.tombstones, q.name, id)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if item, ok := q.byId[id]; ok {
+		heap.Remove(&q.items, item.index)
+		delete(q.byId, id)
+	}
+	return nil
+}
+
+// Consume starts a worker, call it again for more workers.
+func (q *MemoryDelayQueue) Consume(handler Handler) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	handler = q.cfg.handler(q.name, handler)
+	q.workers.Add(1)
+	go func() {
+		defer q.workers.Done()
+		for {
+			item, ok := q.take()
+			if !ok {
+				return
+			}
+			q.handle(handler, item)
+		}
+	}()
+	return nil
+}
+
+// Len returns the number of the messages waiting in the queue.
+func (q *MemoryDelayQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Close drops the messages left in the queue.
+func (q *MemoryDelayQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.stopHandlers()
+		return ctx.Err()
+	}
+}
+
+func (q *MemoryDelayQueue) push(at time.Time, delivery Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	q.seq++
+	item := &memoryItem{at: at, seq: q.seq, delivery: delivery}
+	heap.Push(&q.items, item)
+	q.byId[delivery.Id] = item
+
+	close(q.wake)
+	q.wake = make(chan struct{})
+	return nil
+}
+
+// take waits for the first due message, it returns false once the queue is closed.
+func (q *MemoryDelayQueue) take() (*memoryItem, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, false
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if len(q.items) > 0 {
+			wait := time.Until(q.items[0].at)
+			if wait <= 0 {
+				item := heap.Pop(&q.items).(*memoryItem)
+				delete(q.byId, item.delivery.Id)
+				q.mu.Unlock()
+				return item, true
+			}
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		wake := q.wake
+		q.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-due:
+		case <-q.stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (q *MemoryDelayQueue) handle(handler Handler, item *memoryItem) {
+	ctx := q.handlerCtx
+	logger := log.With("queueName", q.name, "messageId", item.delivery.Id, "attempt", item.delivery.Attempt)
+
+	canceled, err := isCanceled(ctx, q.cfg.tombstones, q.name, item.delivery.Id)
+	if err != nil {
+		logger.Error(err)
+	}
+	if canceled {
+		logger.Info("drop canceled message")
+		return
+	}
+
+	err = handleDelivery(ctx, q.name, handler, item.delivery)
+	if err == nil {
+		return
+	}
+
+	if delay, ok := q.cfg.requeue(err); ok {
+		logger.Info("message is being handled, check it again after ", delay)
+		err = q.push(time.Now().Add(delay), item.delivery)
+		if err != nil {
+			logger.Error("requeue message error: ", err)
+		}
+		return
+	}
+
+	backoff, ok := q.cfg.retry(item.delivery.Attempt, err)
+	if !ok {
+		logger.Error("handle message error, drop it: ", err)
+		return
+	}
+	logger.Warn("handle message error, retry it after ", backoff, ": ", err)
+
+	delivery := item.delivery
+	delivery.Attempt++
+	err = q.push(time.Now().Add(backoff), delivery)
+	if err != nil {
+		logger.Error("retry message error: ", err)
+	}
+}
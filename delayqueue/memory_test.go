@@ -0,0 +1,52 @@
+package delayQueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newMemoryQueue(t *testing.T, opts ...Option) DelayQueue {
+	q, err := NewMemory(testQueueName(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = q.Close(context.TODO())
+	})
+	return q
+}
+
+func TestMemoryDelayQueue(t *testing.T) {
+	testConformance(t, newMemoryQueue)
+}
+
+func TestMemoryDelayQueue_Close(t *testing.T) {
+	q, err := NewMemory(testQueueName())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	for i := 0; i < 3; i++ {
+		_, err = q.PublishAfter(ctx, time.Hour, Message{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e, a := 3, q.Len(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	consume(t, q)
+
+	err = q.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, e := q.PublishAfter(ctx, 0, Message{}); e != ErrClosed {
+		t.Errorf("expected %v, but received %v", ErrClosed, e)
+	}
+	if e, a := ErrClosed, q.Consume(nil); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
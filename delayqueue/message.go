@@ -0,0 +1,140 @@
+package delayQueue
+
+import (
+	"context"
+	"fmt"
+	"github.com/hxy1991/sdk-go/cache"
+	"github.com/hxy1991/sdk-go/log"
+	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// deliverAtHeader is the time in unix milliseconds when a message is due
+	deliverAtHeader = "x-sdk-deliver-at"
+	// tombstoneGrace is how long a canceled message is remembered after it is due,
+	// so that its retries are canceled as well
+	tombstoneGrace = time.Hour * 24
+)
+
+func (d *RabbitMQDelayQueue) PublishAfter(ctx context.Context, delay time.Duration, msg Message) (string, error) {
+	return d.PublishAt(ctx, time.Now().Add(delay), msg)
+}
+
+// PublishAt has no limit to how far at may be, the messages due later than MaxDelay are delayed again by the consumers.
+func (d *RabbitMQDelayQueue) PublishAt(ctx context.Context, at time.Time, msg Message) (string, error) {
+	d.mu.Lock()
+	closed := d.closed
+	d.mu.Unlock()
+	if closed {
+		return "", ErrClosed
+	}
+
+	id := newMessageId(at)
+	err := d.publishAt(ctx, amqp.Publishing{
+		MessageId:   id,
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+		Headers:     withContext(ctx, msg.Headers),
+		Timestamp:   time.Now(),
+	}, at)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (d *RabbitMQDelayQueue) publishAt(ctx context.Context, msg amqp.Publishing, at time.Time) error {
+	if d.readOnly {
+		return ErrReadOnly
+	}
+	msg.Headers = withHeader(msg.Headers, deliverAtHeader, at.UnixMilli())
+
+	delay := time.Until(at)
+	if delay > MaxDelay {
+		delay = MaxDelay
+	}
+	return d.publish(ctx, msg, delay)
+}
+
+// Cancel returns ErrCancelUnsupported unless d has WithTombstoneStore, the consumers may run in other processes.
+func (d *RabbitMQDelayQueue) Cancel(ctx context.Context, id string) error {
+	if d.cfg.tombstones == nil {
+		return ErrCancelUnsupported
+	}
+	return setTombstone(ctx, d.cfg.tombstones, d.name, id)
+}
+
+// guard wraps the handler of Consume, it delays again the messages which are not due yet,
+// and drops the canceled messages.
+func (d *RabbitMQDelayQueue) guard(next rabbitMQ.Handler) rabbitMQ.Handler {
+	return func(ctx context.Context, delivery amqp.Delivery) error {
+		if at, ok := deliverAt(delivery); ok && time.Until(at) > delayUnit {
+			// 超过单次最长延迟的消息再次延迟
+			return d.publishAt(ctx, rabbitMQ.Republishing(delivery, nil), at)
+		}
+
+		if delivery.MessageId != "" && d.cfg.tombstones != nil {
+			canceled, err := isCanceled(ctx, d.cfg.tombstones, d.name, delivery.MessageId)
+			if err != nil {
+				return err
+			}
+			if canceled {
+				log.Context(ctx).With("queueName", d.name, "messageId", delivery.MessageId).Info("drop canceled message")
+				return nil
+			}
+		}
+
+		return next(ctx, delivery)
+	}
+}
+
+func deliverAt(delivery amqp.Delivery) (time.Time, bool) {
+	milli, ok := delivery.Headers[deliverAtHeader].(int64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(milli), true
+}
+
+// setTombstone remembers the canceled message of id until the grace after it is due.
+func setTombstone(ctx context.Context, store cache.Backend, name, id string) error {
+	at, err := parseMessageId(id)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(at)
+	if ttl < 0 {
+		ttl = 0
+	}
+	return store.Set(ctx, getTombstoneKey(name, id), []byte{1}, ttl+tombstoneGrace)
+}
+
+func isCanceled(ctx context.Context, store cache.Backend, name, id string) (bool, error) {
+	_, canceled, err := store.Get(ctx, getTombstoneKey(name, id))
+	if err != nil {
+		return false, fmt.Errorf("check canceled message: %w", err)
+	}
+	return canceled, nil
+}
+
+func getTombstoneKey(name, id string) string {
+	return "delayQueue:" + name + ":canceled:" + id
+}
+
+var (
+	defaultTombstonesOnce  sync.Once
+	defaultTombstonesStore cache.Backend
+)
+
+// defaultTombstones is shared by the MemoryDelayQueues of the process.
+func defaultTombstones() cache.Backend {
+	defaultTombstonesOnce.Do(func() {
+		defaultTombstonesStore = cache.NewLocalBackend(math.MaxInt64, cache.WithCleanupInterval(time.Minute))
+	})
+	return defaultTombstonesStore
+}
@@ -0,0 +1,170 @@
+package delayQueue
+
+import (
+	"context"
+	"fmt"
+	"github.com/hxy1991/sdk-go/cache"
+	"github.com/hxy1991/sdk-go/cache/redis"
+	"github.com/hxy1991/sdk-go/cache/redis/redistest"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"testing"
+	"time"
+)
+
+func TestParseMessageId(t *testing.T) {
+	at := time.UnixMilli(1793491200000)
+	cases := []struct {
+		id          string
+		expected    time.Time
+		expectedErr error
+	}{
+		{id: newMessageId(at), expected: at},
+		{id: "1793491200000-id", expected: at},
+		{id: "id", expectedErr: ErrInvalidMessageId},
+		{id: "at-id", expectedErr: ErrInvalidMessageId},
+	}
+
+	for i, c := range cases {
+		a, err := parseMessageId(c.id)
+		if e := c.expectedErr; e != err {
+			t.Errorf("case %d, expected %v, but received %v", i, e, err)
+		}
+		if e := c.expected; !e.Equal(a) {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestDelayQueue_Guard(t *testing.T) {
+	d := RabbitMQDelayQueue{name: "guard", cfg: config{tombstones: cache.NewLocalBackend(10)}}
+	ctx := context.TODO()
+
+	canceled := newMessageId(time.Now())
+	err := d.Cancel(ctx, canceled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := ErrInvalidMessageId, d.Cancel(ctx, "id"); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	cases := []struct {
+		delivery amqp.Delivery
+		expected bool
+	}{
+		{delivery: amqp.Delivery{MessageId: canceled}, expected: false},
+		{delivery: amqp.Delivery{MessageId: newMessageId(time.Now())}, expected: true},
+		{delivery: amqp.Delivery{}, expected: true},
+		// due already
+		{delivery: amqp.Delivery{Headers: amqp.Table{deliverAtHeader: time.Now().UnixMilli()}}, expected: true},
+	}
+
+	for i, c := range cases {
+		var handled bool
+		err := d.guard(func(ctx context.Context, delivery amqp.Delivery) error {
+			handled = true
+			return nil
+		})(ctx, c.delivery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, a := c.expected, handled; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+// TestDelayQueue_CancelShared cancels a message in the publisher, the consumer is another DelayQueue with
+// another client of the tombstone store.
+func TestDelayQueue_CancelShared(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	newQueue := func() *RabbitMQDelayQueue {
+		client := redis.New(s.Addr)
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+		cfg, err := newConfig([]Option{WithTombstoneStore(client)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &RabbitMQDelayQueue{name: "cancel", cfg: cfg}
+	}
+	publisher, consumer := newQueue(), newQueue()
+	ctx := context.TODO()
+
+	id := newMessageId(time.Now())
+	err = publisher.Cancel(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var handled bool
+	err = consumer.guard(func(ctx context.Context, delivery amqp.Delivery) error {
+		handled = true
+		return nil
+	})(ctx, amqp.Delivery{MessageId: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handled {
+		t.Errorf("expected the message canceled by the publisher to be dropped")
+	}
+
+	unshared := RabbitMQDelayQueue{name: "cancel"}
+	if e, a := ErrCancelUnsupported, unshared.Cancel(ctx, id); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestDelayQueue_PublishAtAndCancel(t *testing.T) {
+	d := newTestRabbitMQ(t, fmt.Sprintf("sdk_go_test_cancel_%d", time.Now().UnixNano()), WithTombstoneStore(cache.NewLocalBackend(10)))
+
+	ctx := context.TODO()
+	at := time.Now().Add(time.Second)
+	canceled, err := d.PublishAt(ctx, at, Message{ContentType: "text/plain", Body: []byte("canceled")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := d.PublishAt(ctx, at, Message{ContentType: "text/plain", Body: []byte("kept"), Headers: map[string]interface{}{"foo": "bar"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Cancel(ctx, canceled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := make(chan Delivery, 10)
+	err = d.Consume(func(ctx context.Context, delivery Delivery) error {
+		deliveries <- delivery
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case delivery := <-deliveries:
+		if e, a := kept, delivery.Id; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if e, a := "bar", delivery.Headers["foo"]; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if time.Now().Before(at) {
+			t.Errorf("expected the message at %v, but received it at %v", at, time.Now())
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatal("expected the message which was not canceled")
+	}
+
+	select {
+	case delivery := <-deliveries:
+		t.Errorf("expected the canceled message to be dropped, but received %v", delivery.Id)
+	case <-time.After(time.Second):
+	}
+}
@@ -0,0 +1,136 @@
+package delayQueue
+
+import (
+	"errors"
+	"github.com/hxy1991/sdk-go/cache"
+	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
+	"time"
+)
+
+type config struct {
+	// tombstones keeps the ids of the canceled messages
+	tombstones      cache.Backend
+	maxAttempts     int
+	minRetryBackoff time.Duration
+	maxRetryBackoff time.Duration
+	pollInterval    time.Duration
+	lease           time.Duration
+	dedup           *Deduplicator
+}
+
+type Option interface {
+	apply(*config) error
+}
+
+type optionFunc func(*config) error
+
+func (f optionFunc) apply(cfg *config) error {
+	return f(cfg)
+}
+
+func newConfig(opts []Option) (config, error) {
+	cfg := config{
+		maxAttempts:  1,
+		pollInterval: delayUnit,
+		lease:        defaultRedisLease,
+	}
+	for _, opt := range opts {
+		err := opt.apply(&cfg)
+		if err != nil {
+			return config{}, err
+		}
+	}
+	return cfg, nil
+}
+
+// WithTombstoneStore keeps the ids of the canceled messages in store, which must be shared by the
+// publishers and the consumers of the DelayQueue, e.g. a redis.Client. RabbitMQDelayQueue requires it
+// to Cancel, RedisDelayQueue keeps them in its client and MemoryDelayQueue in the memory of the process
+// by default.
+func WithTombstoneStore(store cache.Backend) Option {
+	return optionFunc(func(cfg *config) error {
+		if store == nil {
+			return errors.New("tombstone store is nil")
+		}
+		cfg.tombstones = store
+		return nil
+	})
+}
+
+// WithRetry retries a failed message until maxAttempts, the first retry is after minBackoff, which doubles
+// after every attempt up to maxBackoff. The default is no retry. RabbitMQDelayQueue moves the messages to its
+// dead letter queue after the last attempt, the other backends log and drop them.
+func WithRetry(maxAttempts int, minBackoff, maxBackoff time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if maxAttempts < 1 {
+			return errors.New("max attempts must be at least 1")
+		}
+		cfg.maxAttempts = maxAttempts
+		cfg.minRetryBackoff = minBackoff
+		cfg.maxRetryBackoff = maxBackoff
+		if cfg.maxRetryBackoff < cfg.minRetryBackoff {
+			cfg.maxRetryBackoff = cfg.minRetryBackoff
+		}
+		return nil
+	})
+}
+
+// WithPollInterval is how often the consumers of a RedisDelayQueue look for the due messages, the default is 100ms.
+func WithPollInterval(interval time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if interval <= 0 {
+			return errors.New("poll interval must be positive")
+		}
+		cfg.pollInterval = interval
+		return nil
+	})
+}
+
+// WithLease is how long a consumer of a RedisDelayQueue holds a message, the default is 5m. The lease is
+// renewed every third of it while the handler runs, so a shorter lease only shortens the wait after a crash.
+func WithLease(lease time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if lease < time.Millisecond {
+			return errors.New("lease must be at least 1ms")
+		}
+		cfg.lease = lease
+		return nil
+	})
+}
+
+// WithDeduplication makes the consumers skip the messages handled within the window of dedup.
+func WithDeduplication(dedup *Deduplicator) Option {
+	return optionFunc(func(cfg *config) error {
+		if dedup == nil || dedup.store == nil {
+			return errors.New("deduplicator store is nil")
+		}
+		cfg.dedup = dedup
+		return nil
+	})
+}
+
+// handler wraps the handler of Consume with the deduplication if it is enabled.
+func (cfg config) handler(name string, handler Handler) Handler {
+	if cfg.dedup == nil {
+		return handler
+	}
+	return cfg.dedup.wrap(name, handler)
+}
+
+// requeue returns when the message which failed with err is handled again without counting an attempt,
+// i.e. once the lease of the consumer which is handling it expires, see Deduplicator.
+func (cfg config) requeue(err error) (time.Duration, bool) {
+	if cfg.dedup == nil || !errors.Is(err, ErrDuplicateInProgress) {
+		return 0, false
+	}
+	return cfg.dedup.lease(), true
+}
+
+// retry returns the backoff before the next attempt of the message which failed at attempt with err,
+// or false if it is the last one.
+func (cfg config) retry(attempt int, err error) (time.Duration, bool) {
+	if rabbitMQ.IsPermanent(err) || attempt >= cfg.maxAttempts {
+		return 0, false
+	}
+	return rabbitMQ.RetryBackoff(attempt, cfg.minRetryBackoff, cfg.maxRetryBackoff), true
+}
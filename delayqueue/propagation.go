@@ -0,0 +1,163 @@
+package delayQueue
+
+import (
+	"context"
+	"github.com/aws/aws-xray-sdk-go/header"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/hxy1991/sdk-go/constant"
+	"strconv"
+	"strings"
+)
+
+const (
+	// traceHeader is the X-Ray trace header of the publisher
+	traceHeader = "x-sdk-trace"
+	// contextHeaderPrefix prefixes the values of the context of the publisher
+	contextHeaderPrefix = "x-sdk-ctx-"
+)
+
+// contextKind is the type of the value of a context key.
+type contextKind int
+
+const (
+	stringKind contextKind = iota
+	uint64Kind
+	intKind
+)
+
+// contextKeys are the keys of the constant package carried from the context of the publisher to the context
+// of the handler, with the types of their values as log.Context reads them. The values are written as strings,
+// those of other types are not carried.
+var contextKeys = map[string]contextKind{
+	constant.TraceIdKey:              stringKind,
+	constant.GameIdKey:               stringKind,
+	constant.UserIdStrKey:            stringKind,
+	constant.DeviceIdKey:             stringKind,
+	constant.RequestClientIPKey:      stringKind,
+	constant.HandlerLabelKey:         stringKind,
+	constant.RequestModuleKey:        stringKind,
+	constant.RequestActionKey:        stringKind,
+	constant.RequestSubActionsMD5Key: stringKind,
+	constant.ClientVersion:           stringKind,
+	constant.ClientLogicVersion:      stringKind,
+	constant.ChannelIdKey:            stringKind,
+	constant.UserIdUint64Key:         uint64Kind,
+	constant.AccountIdUint64Key:      uint64Kind,
+	constant.ServerIdIntKey:          intKind,
+}
+
+func (k contextKind) format(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, k == stringKind
+	case uint64:
+		return strconv.FormatUint(v, 10), k == uint64Kind
+	case int:
+		return strconv.Itoa(v), k == intKind
+	}
+	return "", false
+}
+
+func (k contextKind) parse(s string) (interface{}, error) {
+	switch k {
+	case uint64Kind:
+		return strconv.ParseUint(s, 10, 64)
+	case intKind:
+		return strconv.Atoi(s)
+	}
+	return s, nil
+}
+
+// withContext copies headers with the trace and the values of contextKeys of ctx.
+func withContext(ctx context.Context, headers map[string]interface{}) map[string]interface{} {
+	table := copyHeaders(headers)
+	set := func(key string, value string) {
+		if table == nil {
+			table = map[string]interface{}{}
+		}
+		table[key] = value
+	}
+
+	for key, kind := range contextKeys {
+		if value, ok := kind.format(ctx.Value(key)); ok {
+			set(contextHeaderPrefix+key, value)
+		}
+	}
+
+	if segment := xray.GetSegment(ctx); segment != nil && xray.TraceID(ctx) != "" {
+		h := header.Header{
+			TraceID:          xray.TraceID(ctx),
+			ParentID:         segment.ID,
+			SamplingDecision: header.NotSampled,
+		}
+		if segment.ParentSegment != nil && segment.ParentSegment.Sampled {
+			h.SamplingDecision = header.Sampled
+		}
+		set(traceHeader, h.String())
+	}
+	return table
+}
+
+// restoreContext adds the values of the context of the publisher in headers to ctx, and returns the trace
+// header of the publisher if there is one.
+func restoreContext(ctx context.Context, headers map[string]interface{}) (context.Context, *header.Header) {
+	var trace *header.Header
+	for k, v := range headers {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if k == traceHeader {
+			trace = header.FromString(s)
+			continue
+		}
+		if !strings.HasPrefix(k, contextHeaderPrefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(k, contextHeaderPrefix)
+		kind, ok := contextKeys[key]
+		if !ok {
+			continue
+		}
+		value, err := kind.parse(s)
+		if err == nil {
+			ctx = context.WithValue(ctx, key, value)
+		}
+	}
+	return ctx, trace
+}
+
+// handleDelivery calls handler in the context of the publisher of delivery, within a segment of its trace.
+func handleDelivery(ctx context.Context, name string, handler Handler, delivery Delivery) (err error) {
+	ctx, trace := restoreContext(ctx, delivery.Headers)
+	delivery.Headers = userHeaders(delivery.Headers)
+
+	if trace != nil && trace.TraceID != "" && !xray.SdkDisabled() {
+		var segment *xray.Segment
+		ctx, segment = xray.NewSegmentFromHeader(ctx, "delayQueue."+name, nil, trace)
+		_ = segment.AddAnnotation("messageId", delivery.Id)
+		_ = segment.AddAnnotation("attempt", delivery.Attempt)
+		defer func() {
+			segment.Close(err)
+		}()
+	}
+
+	return callHandler(ctx, handler, delivery)
+}
+
+// userHeaders returns headers without those of the SDK and of the broker.
+func userHeaders(headers map[string]interface{}) map[string]interface{} {
+	var table map[string]interface{}
+	for k, v := range headers {
+		if strings.HasPrefix(k, "x-sdk-") || strings.HasPrefix(k, "x-death") ||
+			strings.HasPrefix(k, "x-first-death-") || strings.HasPrefix(k, "x-last-death-") || k == "x-delay" {
+			continue
+		}
+		if table == nil {
+			table = make(map[string]interface{}, len(headers))
+		}
+		table[k] = v
+	}
+	return table
+}
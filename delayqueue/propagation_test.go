@@ -0,0 +1,100 @@
+package delayQueue
+
+import (
+	"context"
+	"github.com/aws/aws-xray-sdk-go/header"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/hxy1991/sdk-go/constant"
+	"reflect"
+	"testing"
+)
+
+func TestWithContext(t *testing.T) {
+	ctx := context.TODO()
+	for key, value := range map[string]interface{}{
+		constant.TraceIdKey:         "trace0",
+		constant.GameIdKey:          "game0",
+		constant.UserIdUint64Key:    uint64(1),
+		constant.AccountIdUint64Key: uint64(2),
+		constant.ServerIdIntKey:     3,
+		// not whitelisted
+		constant.RequestBodyKey: "body",
+		// not of the type of the key
+		constant.DeviceIdKey: 4,
+	} {
+		ctx = context.WithValue(ctx, key, value)
+	}
+
+	headers := map[string]interface{}{"foo": "bar"}
+	table := withContext(ctx, headers)
+	e := map[string]interface{}{
+		"foo": "bar",
+		contextHeaderPrefix + constant.TraceIdKey:         "trace0",
+		contextHeaderPrefix + constant.GameIdKey:          "game0",
+		contextHeaderPrefix + constant.UserIdUint64Key:    "1",
+		contextHeaderPrefix + constant.AccountIdUint64Key: "2",
+		contextHeaderPrefix + constant.ServerIdIntKey:     "3",
+	}
+	if a := table; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := 1, len(headers); e != a {
+		t.Errorf("expected headers to be copied, but received %v", headers)
+	}
+
+	restored, trace := restoreContext(context.TODO(), table)
+	if trace != nil {
+		t.Errorf("expected no trace, but received %v", trace)
+	}
+	for key, e := range map[string]interface{}{
+		constant.TraceIdKey:         "trace0",
+		constant.GameIdKey:          "game0",
+		constant.UserIdUint64Key:    uint64(1),
+		constant.AccountIdUint64Key: uint64(2),
+		constant.ServerIdIntKey:     3,
+		constant.RequestBodyKey:     nil,
+		constant.DeviceIdKey:        nil,
+	} {
+		if a := restored.Value(key); e != a {
+			t.Errorf("%s, expected %v, but received %v", key, e, a)
+		}
+	}
+
+	if a := withContext(context.TODO(), nil); a != nil {
+		t.Errorf("expected nil, but received %v", a)
+	}
+}
+
+func TestHandleDelivery_Trace(t *testing.T) {
+	if xray.SdkDisabled() {
+		t.Skip("xray is disabled")
+	}
+
+	ctx, segment := xray.BeginSegment(context.TODO(), "publisher")
+	defer segment.Close(nil)
+	headers := withContext(ctx, nil)
+	trace := header.FromString(headers[traceHeader].(string))
+	if e, a := segment.TraceID, trace.TraceID; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := segment.ID, trace.ParentID; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	var traceId string
+	var handled map[string]interface{}
+	err := handleDelivery(context.TODO(), "trace", func(ctx context.Context, delivery Delivery) error {
+		traceId = xray.TraceID(ctx)
+		handled = delivery.Headers
+		return nil
+	}, Delivery{Headers: headers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := segment.TraceID, traceId; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if handled != nil {
+		t.Errorf("expected the headers of the SDK to be removed, but received %v", handled)
+	}
+}
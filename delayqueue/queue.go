@@ -0,0 +1,105 @@
+package delayQueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMessageId = errors.New("invalid delayQueue message id")
+	ErrClosed           = errors.New("delayQueue is closed")
+	// ErrReadOnly is returned by a RabbitMQDelayQueue of Open on publishing and consuming
+	ErrReadOnly = errors.New("delayQueue is opened read only")
+	// ErrCancelUnsupported is returned by Cancel of a RabbitMQDelayQueue without WithTombstoneStore
+	ErrCancelUnsupported = errors.New("delayQueue has no shared tombstone store to cancel messages")
+)
+
+// DelayQueue delivers the published messages to its consumers once they are due. It is implemented by
+// RabbitMQDelayQueue, RedisDelayQueue and MemoryDelayQueue, the last one suits the unit tests.
+type DelayQueue interface {
+	// PublishAfter delivers msg to the consumers after delay and returns the id of msg, see PublishAt.
+	PublishAfter(ctx context.Context, delay time.Duration, msg Message) (string, error)
+	// PublishAt delivers msg to the consumers at the time at, or at once if it is past, and returns the id
+	// of msg for Cancel.
+	PublishAt(ctx context.Context, at time.Time, msg Message) (string, error)
+	// Cancel makes sure that the message of id is never passed to the handler of Consume, unless it was already.
+	Cancel(ctx context.Context, id string) error
+	// Consume handles the due messages with handler in the background, a message is done once handler
+	// returns nil, see WithRetry for the failed ones. A panic of handler only fails its message.
+	Consume(handler Handler) error
+	// Close stops the consumers once their in-flight messages are handled, or cancels the context of the
+	// handlers and returns the error of ctx if it expires first. Publishing and consuming return ErrClosed
+	// afterwards.
+	Close(ctx context.Context) error
+}
+
+// Message is published to a DelayQueue, the values of Headers must be supported by every backend,
+// i.e. strings, integers, floats and booleans.
+type Message struct {
+	ContentType string
+	Body        []byte
+	Headers     map[string]interface{}
+}
+
+// Delivery is a due message passed to the handler of Consume.
+type Delivery struct {
+	Id          string
+	ContentType string
+	Body        []byte
+	Headers     map[string]interface{}
+	// Timestamp is the time when the message was published
+	Timestamp time.Time
+	// Attempt is the number of the attempt to handle the message, starting at 1
+	Attempt int
+}
+
+type Handler func(ctx context.Context, delivery Delivery) error
+
+// Permanent marks err as not worth retrying, the message fails at once.
+func Permanent(err error) error {
+	return rabbitMQ.Permanent(err)
+}
+
+// callHandler turns a panic of handler into the error of the delivery.
+func callHandler(ctx context.Context, handler Handler, delivery Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("delayQueue handler panic: %v", r)
+		}
+	}()
+	return handler(ctx, delivery)
+}
+
+// newMessageId starts with the time when the message is due, so that Cancel knows how long to remember it.
+func newMessageId(at time.Time) string {
+	return strconv.FormatInt(at.UnixMilli(), 10) + "-" + uuid.NewString()
+}
+
+func parseMessageId(id string) (time.Time, error) {
+	i := strings.IndexByte(id, '-')
+	if i < 0 {
+		return time.Time{}, ErrInvalidMessageId
+	}
+	milli, err := strconv.ParseInt(id[:i], 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidMessageId
+	}
+	return time.UnixMilli(milli), nil
+}
+
+func copyHeaders(headers map[string]interface{}) map[string]interface{} {
+	if headers == nil {
+		return nil
+	}
+	table := make(map[string]interface{}, len(headers))
+	for k, v := range headers {
+		table[k] = v
+	}
+	return table
+}
@@ -0,0 +1,348 @@
+package delayQueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hxy1991/sdk-go/constant"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newQueueFunc returns a DelayQueue of a backend with a name of its own, or skips the test.
+type newQueueFunc func(t *testing.T, opts ...Option) DelayQueue
+
+// testConformance is the behavior shared by all the backends.
+func testConformance(t *testing.T, newQueue newQueueFunc) {
+	ctx := context.TODO()
+
+	t.Run("Order", func(t *testing.T) {
+		q := newQueue(t)
+		deliveries := consume(t, q)
+
+		start := time.Now()
+		delays := map[string]time.Duration{"600ms": time.Millisecond * 600, "300ms": time.Millisecond * 300, "0s": 0}
+		for _, body := range []string{"600ms", "300ms", "0s"} {
+			_, err := q.PublishAfter(ctx, delays[body], Message{ContentType: "text/plain", Body: []byte(body)})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var order []string
+		for len(order) < len(delays) {
+			delivery := receive(t, deliveries)
+			body := string(delivery.Body)
+			order = append(order, body)
+			if elapsed := time.Since(start); elapsed < delays[body] {
+				t.Errorf("expected %s after %v, but received after %v", body, delays[body], elapsed)
+			}
+		}
+		if e, a := []string{"0s", "300ms", "600ms"}, order; !reflect.DeepEqual(e, a) {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+	})
+
+	t.Run("PublishAtPast", func(t *testing.T) {
+		q := newQueue(t)
+		deliveries := consume(t, q)
+
+		id, err := q.PublishAt(ctx, time.Now().Add(-time.Hour), Message{Body: []byte("past")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, a := id, receive(t, deliveries).Id; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+	})
+
+	t.Run("Delivery", func(t *testing.T) {
+		q := newQueue(t)
+		deliveries := consume(t, q)
+
+		before := time.Now().Add(-time.Second)
+		id, err := q.PublishAfter(ctx, time.Millisecond*100, Message{
+			ContentType: "application/json",
+			Body:        []byte(`{"foo":"bar"}`),
+			Headers:     map[string]interface{}{"foo": "bar"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		delivery := receive(t, deliveries)
+		if e, a := id, delivery.Id; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if e, a := "application/json", delivery.ContentType; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if e, a := `{"foo":"bar"}`, string(delivery.Body); e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if e, a := map[string]interface{}{"foo": "bar"}, delivery.Headers; !reflect.DeepEqual(e, a) {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if e, a := 1, delivery.Attempt; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if delivery.Timestamp.Before(before) {
+			t.Errorf("expected the time of publishing, but received %v", delivery.Timestamp)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		q := newQueue(t)
+		deliveries := consume(t, q)
+
+		at := time.Now().Add(time.Millisecond * 300)
+		canceled, err := q.PublishAt(ctx, at, Message{Body: []byte("canceled")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept, err := q.PublishAt(ctx, at, Message{Body: []byte("kept")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = q.Cancel(ctx, canceled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, a := ErrInvalidMessageId, q.Cancel(ctx, "id"); e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+
+		if e, a := kept, receive(t, deliveries).Id; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		select {
+		case delivery := <-deliveries:
+			t.Errorf("expected the canceled message to be dropped, but received %v", delivery.Id)
+		case <-time.After(time.Millisecond * 500):
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		q := newQueue(t)
+		contexts := make(chan context.Context, 10)
+		err := q.Consume(func(ctx context.Context, delivery Delivery) error {
+			contexts <- ctx
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		publishCtx := context.WithValue(context.TODO(), constant.TraceIdKey, "trace0")
+		publishCtx = context.WithValue(publishCtx, constant.UserIdUint64Key, uint64(1))
+		_, err = q.PublishAfter(publishCtx, 0, Message{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case ctx := <-contexts:
+			if e, a := "trace0", ctx.Value(constant.TraceIdKey); e != a {
+				t.Errorf("expected %v, but received %v", e, a)
+			}
+			if e, a := uint64(1), ctx.Value(constant.UserIdUint64Key); e != a {
+				t.Errorf("expected %v, but received %v", e, a)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatal("expected a message")
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		q := newQueue(t)
+		started := make(chan struct{}, 10)
+		release := make(chan struct{})
+		var finished int32
+		err := q.Consume(func(ctx context.Context, delivery Delivery) error {
+			started <- struct{}{}
+			<-release
+			atomic.StoreInt32(&finished, 1)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = q.PublishAfter(ctx, 0, Message{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-started:
+		case <-time.After(time.Second * 10):
+			t.Fatal("expected a message")
+		}
+
+		// the in-flight handler is waited for
+		time.AfterFunc(time.Millisecond*100, func() {
+			close(release)
+		})
+		err = q.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, a := int32(1), atomic.LoadInt32(&finished); e != a {
+			t.Errorf("expected Close to wait for the handler")
+		}
+
+		if _, err := q.PublishAfter(ctx, 0, Message{}); err != ErrClosed {
+			t.Errorf("expected %v, but received %v", ErrClosed, err)
+		}
+		if e, a := ErrClosed, q.Consume(func(ctx context.Context, delivery Delivery) error { return nil }); e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if err := q.Close(ctx); err != nil {
+			t.Errorf("expected Close to be idempotent, but received %v", err)
+		}
+	})
+
+	t.Run("CloseTimeout", func(t *testing.T) {
+		q := newQueue(t)
+		started := make(chan struct{}, 10)
+		canceled := make(chan struct{})
+		err := q.Consume(func(ctx context.Context, delivery Delivery) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			close(canceled)
+			return ctx.Err()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = q.PublishAfter(ctx, 0, Message{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-started:
+		case <-time.After(time.Second * 10):
+			t.Fatal("expected a message")
+		}
+
+		timeout, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+		defer cancel()
+		if e, a := context.DeadlineExceeded, q.Close(timeout); e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		select {
+		case <-canceled:
+		case <-time.After(time.Second * 5):
+			t.Error("expected the context of the handler to be canceled")
+		}
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		q := newQueue(t, WithRetry(3, time.Millisecond*10, time.Millisecond*20))
+		attempts := make(chan int, 10)
+		err := q.Consume(func(ctx context.Context, delivery Delivery) error {
+			attempts <- delivery.Attempt
+			if string(delivery.Body) == "permanent" {
+				return Permanent(errors.New("permanent"))
+			}
+			if delivery.Attempt < 3 {
+				return errors.New("failure")
+			}
+			panic("panic")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, body := range []string{"retried", "permanent"} {
+			_, err = q.PublishAfter(ctx, 0, Message{Body: []byte(body)})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var received []int
+		for len(received) < 4 {
+			select {
+			case attempt := <-attempts:
+				received = append(received, attempt)
+			case <-time.After(time.Second * 10):
+				t.Fatalf("expected 4 attempts, but received %v", received)
+			}
+		}
+		select {
+		case attempt := <-attempts:
+			t.Errorf("expected no more attempts, but received %v", attempt)
+		case <-time.After(time.Millisecond * 300):
+		}
+
+		var count int
+		for _, attempt := range received {
+			if attempt == 1 {
+				count++
+			}
+		}
+		if e, a := 2, count; e != a {
+			t.Errorf("expected %v first attempts, but received %v", e, a)
+		}
+	})
+}
+
+func consume(t *testing.T, q DelayQueue) <-chan Delivery {
+	deliveries := make(chan Delivery, 10)
+	err := q.Consume(func(ctx context.Context, delivery Delivery) error {
+		deliveries <- delivery
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deliveries
+}
+
+func receive(t *testing.T, deliveries <-chan Delivery) Delivery {
+	t.Helper()
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-time.After(time.Second * 10):
+		t.Fatal("expected a message")
+	}
+	return Delivery{}
+}
+
+func testQueueName() string {
+	return fmt.Sprintf("sdk_go_test_%d", time.Now().UnixNano())
+}
+
+func TestConfig_Retry(t *testing.T) {
+	cfg, err := newConfig([]Option{WithRetry(3, time.Second, time.Second*5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("failure")
+	cases := []struct {
+		attempt         int
+		err             error
+		expected        time.Duration
+		expectedRetried bool
+	}{
+		{attempt: 1, err: failure, expected: time.Second, expectedRetried: true},
+		{attempt: 2, err: failure, expected: time.Second * 2, expectedRetried: true},
+		{attempt: 3, err: failure},
+		{attempt: 1, err: Permanent(failure)},
+	}
+
+	for i, c := range cases {
+		backoff, retried := cfg.retry(c.attempt, c.err)
+		if e, a := c.expected, backoff; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		if e, a := c.expectedRetried, retried; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
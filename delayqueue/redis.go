@@ -0,0 +1,389 @@
+package delayQueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hxy1991/sdk-go/cache/redis"
+	"github.com/hxy1991/sdk-go/log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRedisLease is how long a consumer holds a message unless it is renewed, it is delivered again
+	// afterwards if the consumer did not finish it, e.g. because the process exited
+	defaultRedisLease = time.Minute * 5
+	// redisBatch is the number of the due messages claimed by a poll at most
+	redisBatch = 100
+)
+
+// RedisDelayQueue keeps the ids of the messages in a sorted set by the time when they are due, and the
+// messages in keys of their own. The consumers of all the processes poll the sorted set and claim a due
+// message by moving it to the end of a lease, which is renewed while the handler runs, see WithLease.
+// The delivery is at least once: a message whose consumer crashed, or failed to renew its lease, is
+// delivered again with the same Attempt, see WithDeduplication.
+type RedisDelayQueue struct {
+	name   string
+	client *redis.Client
+	cfg    config
+
+	mu      sync.Mutex
+	closed  bool
+	stop    chan struct{}
+	workers sync.WaitGroup
+	// handlerCtx is the context of the handlers, it is canceled once Close gives up waiting for them
+	handlerCtx   context.Context
+	stopHandlers context.CancelFunc
+}
+
+// redisMessage is the payload of a message in redis.
+type redisMessage struct {
+	ContentType string                 `json:"contentType,omitempty"`
+	Body        []byte                 `json:"body,omitempty"`
+	Headers     map[string]interface{} `json:"headers,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+	Attempt     int                    `json:"attempt"`
+}
+
+// NewRedis returns a RedisDelayQueue on client, the tombstones are kept by client as well by default.
+func NewRedis(name string, client *redis.Client, opts ...Option) (*RedisDelayQueue, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.tombstones == nil {
+		cfg.tombstones = client
+	}
+
+	q := &RedisDelayQueue{
+		name:   name,
+		client: client,
+		cfg:    cfg,
+		stop:   make(chan struct{}),
+	}
+	q.handlerCtx, q.stopHandlers = context.WithCancel(context.Background())
+	return q, nil
+}
+
+func (q *RedisDelayQueue) PublishAfter(ctx context.Context, delay time.Duration, msg Message) (string, error) {
+	return q.PublishAt(ctx, time.Now().Add(delay), msg)
+}
+
+// PublishAt delivers the integers of the headers as int64, and the other numbers as float64.
+func (q *RedisDelayQueue) PublishAt(ctx context.Context, at time.Time, msg Message) (string, error) {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return "", ErrClosed
+	}
+
+	id := newMessageId(at)
+	err := q.schedule(ctx, id, at, redisMessage{
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+		Headers:     withContext(ctx, msg.Headers),
+		Timestamp:   time.Now(),
+		Attempt:     1,
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (q *RedisDelayQueue) Cancel(ctx context.Context, id string) error {
+	// the tombstone cancels the retries of a message being handled as well
+	err := setTombstone(ctx, q.cfg.tombstones, q.name, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.client.Do(ctx, "ZREM", q.getScheduleKey(), id)
+	if err != nil {
+		return err
+	}
+	return q.client.Delete(ctx, q.getMessageKey(id))
+}
+
+// Consume starts a worker which polls the due messages, call it again for more workers.
+func (q *RedisDelayQueue) Consume(handler Handler) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	handler = q.cfg.handler(q.name, handler)
+	q.workers.Add(1)
+	go func() {
+		defer q.workers.Done()
+		ticker := time.NewTicker(q.cfg.pollInterval)
+		defer ticker.Stop()
+		for {
+			q.poll(handler)
+
+			select {
+			case <-ticker.C:
+			case <-q.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Close keeps the messages in redis and leaves the client open.
+func (q *RedisDelayQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.stopHandlers()
+		return ctx.Err()
+	}
+}
+
+func (q *RedisDelayQueue) schedule(ctx context.Context, id string, at time.Time, msg redisMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// the message is written first, so that a consumer never claims an id without its message
+	err = q.client.Set(ctx, q.getMessageKey(id), data, 0)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.Do(ctx, "ZADD", q.getScheduleKey(), strconv.FormatInt(at.UnixMilli(), 10), id)
+	return err
+}
+
+// poll handles the due messages until there is none left or the queue is closed.
+func (q *RedisDelayQueue) poll(handler Handler) {
+	ctx := q.handlerCtx
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		ids, err := q.due(ctx)
+		if err != nil {
+			log.With("queueName", q.name).Error("poll messages error ", err)
+			return
+		}
+		if len(ids) == 0 {
+			return
+		}
+
+		for _, id := range ids {
+			ok, err := q.claim(ctx, id)
+			if err != nil {
+				log.With("queueName", q.name, "messageId", id).Error("claim message error ", err)
+				continue
+			}
+			if ok {
+				q.handle(ctx, handler, id)
+			}
+		}
+	}
+}
+
+func (q *RedisDelayQueue) due(ctx context.Context) ([]string, error) {
+	reply, err := q.client.Do(ctx, "ZRANGEBYSCORE", q.getScheduleKey(), "-inf",
+		strconv.FormatInt(time.Now().UnixMilli(), 10), "LIMIT", "0", strconv.Itoa(redisBatch))
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T of ZRANGEBYSCORE", reply)
+	}
+
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		id, ok := item.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("redis: unexpected member %T of ZRANGEBYSCORE", item)
+		}
+		ids = append(ids, string(id))
+	}
+	return ids, nil
+}
+
+// redisClaimScript moves id to the end of the lease if it is still due, which fails for the consumers
+// whose poll saw it before another consumer claimed it.
+const redisClaimScript = `local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+	return 1
+end
+return 0`
+
+// claim schedules id again at the end of the lease in case the consumer does not finish it,
+// only one of the consumers succeeds.
+func (q *RedisDelayQueue) claim(ctx context.Context, id string) (bool, error) {
+	now := time.Now()
+	reply, err := q.client.Eval(ctx, redisClaimScript, []string{q.getScheduleKey()}, id,
+		strconv.FormatInt(now.UnixMilli(), 10), strconv.FormatInt(now.Add(q.cfg.lease).UnixMilli(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+func (q *RedisDelayQueue) handle(ctx context.Context, handler Handler, id string) {
+	logger := log.With("queueName", q.name, "messageId", id)
+
+	msg, found, err := q.get(ctx, id)
+	if err != nil {
+		logger.Error("get message error ", err)
+		return
+	}
+	if !found {
+		// canceled, the id is left from the lease
+		q.done(ctx, id)
+		return
+	}
+
+	canceled, err := isCanceled(ctx, q.cfg.tombstones, q.name, id)
+	if err != nil {
+		logger.Error(err)
+	}
+	if canceled {
+		logger.Info("drop canceled message")
+		q.done(ctx, id)
+		return
+	}
+
+	stop := q.renew(ctx, id)
+	err = handleDelivery(ctx, q.name, handler, Delivery{
+		Id:          id,
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+		Headers:     msg.Headers,
+		Timestamp:   msg.Timestamp,
+		Attempt:     msg.Attempt,
+	})
+	stop()
+	if err == nil {
+		q.done(ctx, id)
+		return
+	}
+
+	logger = logger.With("attempt", msg.Attempt)
+	if delay, ok := q.cfg.requeue(err); ok {
+		logger.Info("message is being handled, check it again after ", delay)
+		err = q.schedule(ctx, id, time.Now().Add(delay), msg)
+		if err != nil {
+			// the message is delivered again at the end of the lease
+			logger.Error("requeue message error ", err)
+		}
+		return
+	}
+
+	backoff, ok := q.cfg.retry(msg.Attempt, err)
+	if !ok {
+		logger.Error("handle message error, drop it: ", err)
+		q.done(ctx, id)
+		return
+	}
+	logger.Warn("handle message error, retry it after ", backoff, ": ", err)
+
+	msg.Attempt++
+	err = q.schedule(ctx, id, time.Now().Add(backoff), msg)
+	if err != nil {
+		// the message is delivered again at the end of the lease
+		logger.Error("retry message error ", err)
+	}
+}
+
+// renew moves the lease of id forward until stop is called, stop returns once the lease is not renewed
+// any more. ZADD XX does not add id again once it is done.
+func (q *RedisDelayQueue) renew(ctx context.Context, id string) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(q.cfg.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := q.client.Do(ctx, "ZADD", q.getScheduleKey(), "XX",
+					strconv.FormatInt(time.Now().Add(q.cfg.lease).UnixMilli(), 10), id)
+				if err != nil {
+					log.With("queueName", q.name, "messageId", id).Error("renew message lease error ", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (q *RedisDelayQueue) get(ctx context.Context, id string) (redisMessage, bool, error) {
+	data, found, err := q.client.Get(ctx, q.getMessageKey(id))
+	if err != nil || !found {
+		return redisMessage{}, found, err
+	}
+
+	var msg redisMessage
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&msg)
+	if err != nil {
+		return redisMessage{}, false, err
+	}
+	for k, v := range msg.Headers {
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				msg.Headers[k] = i
+			} else {
+				msg.Headers[k], _ = n.Float64()
+			}
+		}
+	}
+	return msg, true, nil
+}
+
+// done removes the message of id once it is finished.
+func (q *RedisDelayQueue) done(ctx context.Context, id string) {
+	_, err := q.client.Do(ctx, "ZREM", q.getScheduleKey(), id)
+	if err == nil {
+		err = q.client.Delete(ctx, q.getMessageKey(id))
+	}
+	if err != nil {
+		log.With("queueName", q.name, "messageId", id).Error("remove message error ", err)
+	}
+}
+
+func (q *RedisDelayQueue) getScheduleKey() string {
+	return q.client.Key("delayQueue:" + q.name + ":schedule")
+}
+
+func (q *RedisDelayQueue) getMessageKey(id string) string {
+	return "delayQueue:" + q.name + ":message:" + id
+}
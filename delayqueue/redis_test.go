@@ -0,0 +1,163 @@
+package delayQueue
+
+import (
+	"context"
+	"github.com/hxy1991/sdk-go/cache/redis"
+	"github.com/hxy1991/sdk-go/cache/redis/redistest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRedisQueue(t *testing.T, opts ...Option) DelayQueue {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	s.RegisterScript(redisClaimScript, claimScript)
+	client := redis.New(s.Addr, redis.WithKeyPrefix("test:"))
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	q, err := NewRedis(testQueueName(), client, append([]Option{WithPollInterval(time.Millisecond * 10)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = q.Close(context.TODO())
+	})
+	return q
+}
+
+// claimScript is redisClaimScript for redistest.
+func claimScript(call func(args ...string) interface{}, keys, args []string) interface{} {
+	reply, ok := call("ZSCORE", keys[0], args[0]).([]byte)
+	if !ok {
+		return int64(0)
+	}
+	score, _ := strconv.ParseFloat(string(reply), 64)
+	now, _ := strconv.ParseFloat(args[1], 64)
+	if score > now {
+		return int64(0)
+	}
+	call("ZADD", keys[0], args[2], args[0])
+	return int64(1)
+}
+
+func TestRedisDelayQueue(t *testing.T) {
+	testConformance(t, newRedisQueue)
+}
+
+// TestRedisDelayQueue_Workers runs several workers on the same queue, every message is handled once.
+func TestRedisDelayQueue_Workers(t *testing.T) {
+	q := newRedisQueue(t)
+	ctx := context.TODO()
+
+	var deliveries []<-chan Delivery
+	for i := 0; i < 3; i++ {
+		deliveries = append(deliveries, consume(t, q))
+	}
+	for i := 0; i < 5; i++ {
+		_, err := q.PublishAfter(ctx, 0, Message{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := map[string]int{}
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case delivery := <-deliveries[0]:
+			received[delivery.Id]++
+		case delivery := <-deliveries[1]:
+			received[delivery.Id]++
+		case delivery := <-deliveries[2]:
+			received[delivery.Id]++
+		case <-timeout:
+			done = true
+		}
+	}
+	if e, a := 5, len(received); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	for id, count := range received {
+		if count != 1 {
+			t.Errorf("expected %v once, but received %v times", id, count)
+		}
+	}
+}
+
+// TestRedisDelayQueue_Claim claims a message once, a consumer with a stale poll fails to claim it again.
+func TestRedisDelayQueue_Claim(t *testing.T) {
+	q := newRedisQueue(t).(*RedisDelayQueue)
+	ctx := context.TODO()
+
+	id, err := q.PublishAfter(ctx, 0, Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range []bool{true, false} {
+		ok, err := q.claim(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := ok; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+// TestRedisDelayQueue_Lease renews the lease of a message while its handler outlives it.
+func TestRedisDelayQueue_Lease(t *testing.T) {
+	lease := time.Millisecond * 100
+	q := newRedisQueue(t, WithLease(lease))
+
+	var calls int32
+	for i := 0; i < 2; i++ {
+		err := q.Consume(func(ctx context.Context, delivery Delivery) error {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(lease * 4)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := q.PublishAfter(context.TODO(), 0, Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(lease * 6)
+	if e, a := int32(1), atomic.LoadInt32(&calls); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	if _, err := NewRedis(testQueueName(), nil, WithLease(0)); err == nil {
+		t.Errorf("expected an error for a lease of 0")
+	}
+}
+
+func TestRedisDelayQueue_Headers(t *testing.T) {
+	q := newRedisQueue(t)
+	deliveries := consume(t, q)
+
+	_, err := q.PublishAfter(context.TODO(), 0, Message{Headers: map[string]interface{}{"int": 1, "float": 1.5, "bool": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := receive(t, deliveries).Headers
+	if e, a := int64(1), headers["int"]; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := 1.5, headers["float"]; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := true, headers["bool"]; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
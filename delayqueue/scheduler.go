@@ -0,0 +1,315 @@
+package delayQueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hxy1991/sdk-go/log"
+	rabbitMQ "github.com/hxy1991/sdk-go/mq/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The delays are implemented by levels of queues shared by all the DelayQueues, the queue of the level n
+// keeps the messages for 2^n delay units. As all the messages of a queue have the same TTL, a message never
+// waits behind a longer one. The routing key of a message has a word per level, from the highest one,
+// which is 1 if the message goes through the queue of the level, or 0 if it skips it, e.g. 0.0...1.0.1 waits
+// for 5 units. At the end the delivery exchange routes the message to its consumer queue by its header.
+const (
+	// delayUnit is the precision of the delays, they are rounded up to it
+	delayUnit = time.Millisecond * 100
+	// delayLevels keeps the TTL of the highest level within the limit of the broker, see maxMessageTTL
+	delayLevels = 26
+	// maxMessageTTL is the longest x-message-ttl the broker accepts
+	maxMessageTTL = time.Millisecond * (1<<32 - 1)
+
+	delayLevelPrefix      = "sdk-go.delay.level."
+	delayDeliveryExchange = "sdk-go.delay.delivery"
+	// delayQueueHeader is the consumer queue of a message
+	delayQueueHeader = "x-sdk-delay-queue"
+
+	delayedMessageExchangeType = "x-delayed-message"
+	// delayedMessageCheckExchange is declared and deleted to check for the plugin
+	delayedMessageCheckExchange = "sdk-go.delay.plugin-check"
+	// delayedMessageMaxDelay is the longest delay of the x-delayed-message plugin, a longer one goes through the levels
+	delayedMessageMaxDelay = maxMessageTTL
+)
+
+// MaxDelay is the longest delay of a single pass through the levels, about 77 days,
+// PublishAt delays a longer one again once it is consumed.
+const MaxDelay = delayUnit * (1<<delayLevels - 1)
+
+var ErrDelayTooLong = fmt.Errorf("delay is longer than %v", MaxDelay)
+
+// scheduler routes a message to the consumer queue at the end of its delay.
+type scheduler interface {
+	publish(ctx context.Context, msg amqp.Publishing, delay time.Duration) error
+}
+
+func levelName(level int) string {
+	return fmt.Sprintf("%s%02d", delayLevelPrefix, level)
+}
+
+// levelTTL is how long the messages wait in the queue of the level.
+func levelTTL(level int) time.Duration {
+	return delayUnit << level
+}
+
+// levelNext is where the messages go after the level, either waiting in its queue or skipping it.
+func levelNext(level int) string {
+	if level == 0 {
+		return delayDeliveryExchange
+	}
+	return levelName(level - 1)
+}
+
+// levelRoutingKey returns the routing key of the delay, which is rounded up to the delay unit.
+func levelRoutingKey(delay time.Duration) (string, error) {
+	if delay > MaxDelay {
+		return "", ErrDelayTooLong
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	units := uint64((delay + delayUnit - 1) / delayUnit)
+
+	words := make([]string, delayLevels)
+	for level := 0; level < delayLevels; level++ {
+		words[delayLevels-1-level] = fmt.Sprint(units >> level & 1)
+	}
+	return strings.Join(words, "."), nil
+}
+
+// levelPattern matches the routing keys whose word of the level is bit.
+func levelPattern(level int, bit string) string {
+	return strings.Repeat("*.", delayLevels-1-level) + bit + ".#"
+}
+
+var (
+	levelsMu sync.Mutex
+	// levelsDeclaredOn is the connection where the levels were declared last
+	levelsDeclaredOn *rabbitMQ.Connection
+)
+
+// declareLevels declares the levels on the connection once, they are declared again after reconnecting.
+func declareLevels(c *rabbitMQ.Connection) error {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	if levelsDeclaredOn == c {
+		return nil
+	}
+
+	err := c.DeclareExchange(rabbitMQ.Exchange{
+		Name:    delayDeliveryExchange,
+		Kind:    amqp.ExchangeHeaders,
+		Durable: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for level := 0; level < delayLevels; level++ {
+		name := levelName(level)
+		err := c.DeclareExchange(rabbitMQ.Exchange{
+			Name:    name,
+			Kind:    amqp.ExchangeTopic,
+			Durable: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = c.DeclareQueue(rabbitMQ.Queue{
+			Name:    name,
+			Durable: true,
+			Args: amqp.Table{
+				"x-message-ttl": levelTTL(level).Milliseconds(),
+				// 过期后保留原 routing key 转发到下一级
+				"x-dead-letter-exchange": levelNext(level),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		err = c.BindQueue(rabbitMQ.Binding{
+			Queue:    name,
+			Key:      levelPattern(level, "1"),
+			Exchange: name,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = c.BindExchange(rabbitMQ.ExchangeBinding{
+			Destination: levelNext(level),
+			Key:         levelPattern(level, "0"),
+			Source:      name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	levelsDeclaredOn = c
+	return nil
+}
+
+// levelScheduler delays the messages through the levels.
+type levelScheduler struct {
+	producer *rabbitMQ.Connection
+	queue    string
+}
+
+func newLevelScheduler(producer, consumer *rabbitMQ.Connection, queue string) (*levelScheduler, error) {
+	err := declareLevels(producer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = consumer.BindQueue(rabbitMQ.Binding{
+		Queue:    queue,
+		Exchange: delayDeliveryExchange,
+		Args: amqp.Table{
+			"x-match":        "all",
+			delayQueueHeader: queue,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &levelScheduler{producer: producer, queue: queue}, nil
+}
+
+func (s *levelScheduler) publish(ctx context.Context, msg amqp.Publishing, delay time.Duration) error {
+	key, err := levelRoutingKey(delay)
+	if err != nil {
+		return err
+	}
+
+	msg.Headers = withHeader(msg.Headers, delayQueueHeader, s.queue)
+	// 等待 broker 确认，无法路由时消息会被退回
+	return s.producer.PublishWithConfirm(ctx, levelName(delayLevels-1), key, true, msg)
+}
+
+// pluginScheduler delays the messages with the x-delayed-message exchange of the plugin of the broker.
+type pluginScheduler struct {
+	producer *rabbitMQ.Connection
+	exchange string
+	queue    string
+	// levels delays the messages longer than the plugin allows
+	levels *levelScheduler
+}
+
+var (
+	pluginMu sync.Mutex
+	// pluginCheckedOn is the connection whose broker was checked for the plugin last
+	pluginCheckedOn *rabbitMQ.Connection
+	pluginAvailable bool
+)
+
+// hasDelayedMessagePlugin checks once whether the broker of the connection has the x-delayed-message plugin.
+// The check goes through a connection of its own, as the broker closes the connection which declares an
+// exchange of an unknown type.
+func hasDelayedMessagePlugin(c *rabbitMQ.Connection) (bool, error) {
+	pluginMu.Lock()
+	defer pluginMu.Unlock()
+
+	if pluginCheckedOn == c {
+		return pluginAvailable, nil
+	}
+
+	err := c.Probe(func(ch *amqp.Channel) error {
+		err := ch.ExchangeDeclare(delayedMessageCheckExchange, delayedMessageExchangeType, false, true, false, false,
+			amqp.Table{"x-delayed-type": amqp.ExchangeDirect})
+		if err != nil {
+			return err
+		}
+		return ch.ExchangeDelete(delayedMessageCheckExchange, false, false)
+	})
+	var amqpErr *amqp.Error
+	switch {
+	case err == nil:
+		pluginAvailable = true
+	case errors.As(err, &amqpErr) && amqpErr.Code == amqp.CommandInvalid:
+		// unknown exchange type
+		pluginAvailable = false
+	default:
+		return false, err
+	}
+
+	pluginCheckedOn = c
+	return pluginAvailable, nil
+}
+
+// newPluginScheduler returns false if the broker does not have the x-delayed-message plugin.
+func newPluginScheduler(producer, consumer *rabbitMQ.Connection, exchange, queue string, levels *levelScheduler) (*pluginScheduler, bool, error) {
+	ok, err := hasDelayedMessagePlugin(producer)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	err = producer.DeclareExchange(rabbitMQ.Exchange{
+		Name:    exchange,
+		Kind:    delayedMessageExchangeType,
+		Durable: true,
+		Args:    amqp.Table{"x-delayed-type": amqp.ExchangeDirect},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = consumer.BindQueue(rabbitMQ.Binding{
+		Queue:    queue,
+		Key:      queue,
+		Exchange: exchange,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &pluginScheduler{producer: producer, exchange: exchange, queue: queue, levels: levels}, true, nil
+}
+
+func (s *pluginScheduler) publish(ctx context.Context, msg amqp.Publishing, delay time.Duration) error {
+	if delay > delayedMessageMaxDelay {
+		return s.levels.publish(ctx, msg, delay)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+
+	msg.Headers = withHeader(msg.Headers, "x-delay", delay.Milliseconds())
+	// the plugin routes the messages at the end of their delays, so they can not be mandatory
+	return s.producer.PublishWithConfirm(ctx, s.exchange, s.queue, false, msg)
+}
+
+// newScheduler uses the x-delayed-message plugin if the broker has it, or the levels otherwise.
+func newScheduler(d *RabbitMQDelayQueue) (scheduler, error) {
+	levels, err := newLevelScheduler(d.producer, d.consumer, d.getQueueNameForConsumer())
+	if err != nil {
+		return nil, err
+	}
+
+	plugin, ok, err := newPluginScheduler(d.producer, d.consumer, d.getDelayedExchange(), d.getQueueNameForConsumer(), levels)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		log.With("queueName", d.name).Info("delayQueue uses the x-delayed-message plugin")
+		return plugin, nil
+	}
+	log.With("queueName", d.name).Info("delayQueue uses the delay levels")
+	return levels, nil
+}
+
+func withHeader(headers amqp.Table, key string, value interface{}) amqp.Table {
+	table := make(amqp.Table, len(headers)+1)
+	for k, v := range headers {
+		table[k] = v
+	}
+	table[key] = value
+	return table
+}
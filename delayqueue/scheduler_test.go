@@ -0,0 +1,116 @@
+package delayQueue
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelRoutingKey(t *testing.T) {
+	zeros := strings.Repeat("0.", delayLevels-3)
+	cases := []struct {
+		delay       time.Duration
+		expected    string
+		expectedErr error
+	}{
+		{delay: 0, expected: zeros + "0.0.0"},
+		{delay: -time.Second, expected: zeros + "0.0.0"},
+		{delay: delayUnit, expected: zeros + "0.0.1"},
+		// rounded up to the delay unit
+		{delay: delayUnit*4 + 1, expected: zeros + "1.0.1"},
+		{delay: MaxDelay, expected: strings.Repeat("1.", delayLevels-1) + "1"},
+		{delay: MaxDelay + 1, expectedErr: ErrDelayTooLong},
+	}
+
+	for i, c := range cases {
+		key, err := levelRoutingKey(c.delay)
+		if e, a := c.expectedErr, err; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		if e, a := c.expected, key; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestLevelPattern(t *testing.T) {
+	cases := []struct {
+		level    int
+		bit      string
+		expected string
+	}{
+		{level: delayLevels - 1, bit: "1", expected: "1.#"},
+		{level: 0, bit: "0", expected: strings.Repeat("*.", delayLevels-1) + "0.#"},
+	}
+
+	for i, c := range cases {
+		if e, a := c.expected, levelPattern(c.level, c.bit); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestLevelTTL(t *testing.T) {
+	for level := 0; level < delayLevels; level++ {
+		if ttl := levelTTL(level); ttl > maxMessageTTL {
+			t.Errorf("level %d, expected a ttl of at most %v, but received %v", level, maxMessageTTL, ttl)
+		}
+	}
+}
+
+func TestLevelNext(t *testing.T) {
+	if e, a := delayDeliveryExchange, levelNext(0); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := "sdk-go.delay.level.04", levelNext(5); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+// TestDelayQueue_MixedDelays publishes the longest delay first, the messages are still delivered
+// in the order of their delays.
+func TestDelayQueue_MixedDelays(t *testing.T) {
+	d := newTestRabbitMQ(t, fmt.Sprintf("sdk_go_test_mixed_delays_%d", time.Now().UnixNano()))
+
+	type received struct {
+		body string
+		at   time.Time
+	}
+	deliveries := make(chan received, 10)
+	err := d.Consume(func(ctx context.Context, delivery Delivery) error {
+		deliveries <- received{body: string(delivery.Body), at: time.Now()}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	delays := map[string]int{"3s": 3000, "1s": 1000, "300ms": 300, "0s": 0}
+	for _, body := range []string{"3s", "1s", "300ms", "0s"} {
+		err = d.Publish(context.TODO(), "text/plain", body, delays[body])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var order []string
+	for len(order) < len(delays) {
+		select {
+		case r := <-deliveries:
+			order = append(order, r.body)
+			if elapsed, delay := r.at.Sub(start), time.Duration(delays[r.body])*time.Millisecond; elapsed < delay {
+				t.Errorf("expected %s after %v, but received after %v", r.body, delay, elapsed)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatalf("expected all the messages, but received %v", order)
+		}
+	}
+
+	if e, a := []string{"0s", "300ms", "1s", "3s"}, order; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
@@ -0,0 +1,104 @@
+package delayQueue
+
+import (
+	"context"
+	"fmt"
+	"github.com/hxy1991/sdk-go/codec"
+	"time"
+)
+
+// TypedDelayQueue publishes and consumes the values of T over a DelayQueue, encoded by a codec.
+type TypedDelayQueue[T any] struct {
+	queue DelayQueue
+	codec codec.Codec
+}
+
+// Metadata is what a typed handler receives along with the decoded value.
+type Metadata struct {
+	Id          string
+	ContentType string
+	Headers     map[string]interface{}
+	// Timestamp is the time when the message was published
+	Timestamp time.Time
+	// Attempt is the number of the attempt to handle the message, starting at 1
+	Attempt int
+}
+
+type TypedHandler[T any] func(ctx context.Context, value T, meta Metadata) error
+
+// NewTyped encodes the values with c, codec.JSON if c is nil. Use codec.Proto for a T of proto.Message,
+// e.g. NewTyped[*pb.Order](queue, codec.Proto).
+func NewTyped[T any](queue DelayQueue, c codec.Codec) *TypedDelayQueue[T] {
+	if c == nil {
+		c = codec.JSON
+	}
+	return &TypedDelayQueue[T]{queue: queue, codec: c}
+}
+
+// Queue returns the underlying DelayQueue.
+func (q *TypedDelayQueue[T]) Queue() DelayQueue {
+	return q.queue
+}
+
+// PublishAfter encodes value, headers may be nil.
+func (q *TypedDelayQueue[T]) PublishAfter(ctx context.Context, delay time.Duration, value T, headers map[string]interface{}) (string, error) {
+	return q.PublishAt(ctx, time.Now().Add(delay), value, headers)
+}
+
+// PublishAt encodes value, headers may be nil.
+func (q *TypedDelayQueue[T]) PublishAt(ctx context.Context, at time.Time, value T, headers map[string]interface{}) (string, error) {
+	body, err := q.codec.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("encode delayQueue message: %w", err)
+	}
+	return q.queue.PublishAt(ctx, at, Message{
+		ContentType: q.codec.ContentType(),
+		Body:        body,
+		Headers:     headers,
+	})
+}
+
+func (q *TypedDelayQueue[T]) Cancel(ctx context.Context, id string) error {
+	return q.queue.Cancel(ctx, id)
+}
+
+// Consume passes the decoded values to handler, see DelayQueue.Consume. A message is decoded by the built-in
+// codec of its content type, or by the codec of q if it has none. A message which can not be decoded fails
+// without a retry.
+func (q *TypedDelayQueue[T]) Consume(handler TypedHandler[T]) error {
+	return q.queue.Consume(func(ctx context.Context, delivery Delivery) error {
+		value, err := q.decode(delivery)
+		if err != nil {
+			return Permanent(err)
+		}
+		return handler(ctx, value, Metadata{
+			Id:          delivery.Id,
+			ContentType: delivery.ContentType,
+			Headers:     delivery.Headers,
+			Timestamp:   delivery.Timestamp,
+			Attempt:     delivery.Attempt,
+		})
+	})
+}
+
+func (q *TypedDelayQueue[T]) Close(ctx context.Context) error {
+	return q.queue.Close(ctx)
+}
+
+func (q *TypedDelayQueue[T]) decode(delivery Delivery) (T, error) {
+	var value T
+
+	c := q.codec
+	if delivery.ContentType != "" && delivery.ContentType != c.ContentType() {
+		c = codec.ByContentType(delivery.ContentType)
+		if c == nil {
+			return value, fmt.Errorf("decode delayQueue message: unsupported content type %s", delivery.ContentType)
+		}
+	}
+
+	err := c.Unmarshal(delivery.Body, &value)
+	if err != nil {
+		return value, fmt.Errorf("decode delayQueue message: %w", err)
+	}
+	return value, nil
+}
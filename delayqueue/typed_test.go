@@ -0,0 +1,141 @@
+package delayQueue
+
+import (
+	"context"
+	"github.com/hxy1991/sdk-go/codec"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type order struct {
+	Id     string
+	Amount int
+}
+
+func TestTypedDelayQueue_JSON(t *testing.T) {
+	q := NewTyped[order](newMemoryQueue(t), nil)
+	type received struct {
+		value order
+		meta  Metadata
+	}
+	deliveries := make(chan received, 10)
+	err := q.Consume(func(ctx context.Context, value order, meta Metadata) error {
+		deliveries <- received{value: value, meta: meta}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := order{Id: "order0", Amount: 100}
+	id, err := q.PublishAfter(context.TODO(), time.Millisecond*10, e, map[string]interface{}{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case a := <-deliveries:
+		if !reflect.DeepEqual(e, a.value) {
+			t.Errorf("expected %v, but received %v", e, a.value)
+		}
+		if e, a := id, a.meta.Id; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if e, a := codec.JSON.ContentType(), a.meta.ContentType; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if e, a := "bar", a.meta.Headers["foo"]; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		if e, a := 1, a.meta.Attempt; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected a message")
+	}
+}
+
+func TestTypedDelayQueue_Proto(t *testing.T) {
+	q := NewTyped[*wrapperspb.StringValue](newMemoryQueue(t), codec.Proto)
+	values := make(chan *wrapperspb.StringValue, 10)
+	err := q.Consume(func(ctx context.Context, value *wrapperspb.StringValue, meta Metadata) error {
+		values <- value
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = q.PublishAfter(context.TODO(), 0, wrapperspb.String("value0"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case a := <-values:
+		if e, a := "value0", a.GetValue(); e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected a message")
+	}
+}
+
+func TestTypedDelayQueue_Decode(t *testing.T) {
+	q := NewTyped[order](nil, codec.JSON)
+	cases := []struct {
+		delivery    Delivery
+		expected    order
+		expectedErr bool
+	}{
+		{delivery: Delivery{Body: []byte(`{"Id":"order0"}`)}, expected: order{Id: "order0"}},
+		{delivery: Delivery{ContentType: "application/json", Body: []byte(`{"Amount":1}`)}, expected: order{Amount: 1}},
+		{delivery: Delivery{ContentType: "text/plain", Body: []byte(`{}`)}, expectedErr: true},
+		{delivery: Delivery{Body: []byte(`order0`)}, expectedErr: true},
+	}
+
+	for i, c := range cases {
+		a, err := q.decode(c.delivery)
+		if e, a := c.expectedErr, err != nil; e != a {
+			t.Errorf("case %d, expected error %v, but received %v", i, e, err)
+		}
+		if e := c.expected; !reflect.DeepEqual(e, a) {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+// TestTypedDelayQueue_DecodeError never retries a message which can not be decoded.
+func TestTypedDelayQueue_DecodeError(t *testing.T) {
+	queue := newMemoryQueue(t, WithRetry(3, time.Millisecond, time.Millisecond))
+	q := NewTyped[order](queue, nil)
+	handled := make(chan struct{}, 10)
+	err := q.Consume(func(ctx context.Context, value order, meta Metadata) error {
+		handled <- struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = queue.PublishAfter(context.TODO(), 0, Message{ContentType: "text/plain", Body: []byte("order0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	select {
+	case <-handled:
+		t.Errorf("expected the message to be dropped")
+	default:
+	}
+	if e, a := 0, queue.(*MemoryDelayQueue).Len(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	if _, err := NewTyped[func()](queue, nil).PublishAfter(context.TODO(), 0, func() {}, nil); err == nil {
+		t.Errorf("expected an error for a value which can not be encoded")
+	}
+}
@@ -0,0 +1,215 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hxy1991/sdk-go/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"sync"
+)
+
+// publishTagHeader carries the delivery tag of a mandatory message, so that a return of the broker,
+// which has no delivery tag, can be matched to its publishing. The consumers remove it, see withoutPublishTag.
+const publishTagHeader = "x-sdk-publish-tag"
+
+// withoutPublishTag removes publishTagHeader from the headers of d, which are copied if it has it.
+func withoutPublishTag(d amqp.Delivery) amqp.Delivery {
+	if _, found := d.Headers[publishTagHeader]; !found {
+		return d
+	}
+	headers := make(amqp.Table, len(d.Headers)-1)
+	for k, v := range d.Headers {
+		if k != publishTagHeader {
+			headers[k] = v
+		}
+	}
+	d.Headers = headers
+	return d
+}
+
+var (
+	// ErrNacked means the broker could not take the message, e.g. because of an internal error
+	ErrNacked = errors.New("rabbitmq: message is nacked by the broker")
+	// ErrChannelClosed means the channel was closed before the broker confirmed the message,
+	// which may or may not have been taken
+	ErrChannelClosed = errors.New("rabbitmq: channel is closed before the message is confirmed")
+)
+
+// ReturnError means a mandatory message could not be routed to any queue.
+type ReturnError struct {
+	Return amqp.Return
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("rabbitmq: message to exchange [%s] with key [%s] is returned by the broker: %d %s",
+		e.Return.Exchange, e.Return.RoutingKey, e.Return.ReplyCode, e.Return.ReplyText)
+}
+
+// Confirmation is the outcome of a message published by PublishAsync.
+type Confirmation struct {
+	done chan struct{}
+	err  error
+}
+
+func newConfirmation() *Confirmation {
+	return &Confirmation{done: make(chan struct{})}
+}
+
+// Done is closed once the broker has confirmed the message, or the channel was closed.
+func (c *Confirmation) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns nil if the broker has taken the message, ErrNacked, a *ReturnError or ErrChannelClosed
+// otherwise. It must be called after Done is closed.
+func (c *Confirmation) Err() error {
+	return c.err
+}
+
+// Wait waits for the confirmation of the broker, if ctx is done first it returns ctx.Err(),
+// and the message may still be taken by the broker.
+func (c *Confirmation) Wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Confirmation) resolve(err error) {
+	c.err = err
+	close(c.done)
+}
+
+// confirmer matches the acks, nacks and returns of a channel in confirm mode to its publishings.
+type confirmer struct {
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+
+	mu      sync.Mutex
+	pending map[uint64]*Confirmation
+	// returned are the returns whose ack has not been received yet
+	returned map[uint64]amqp.Return
+}
+
+func newConfirmer(ch *amqp.Channel) *confirmer {
+	cc := &confirmer{
+		ch: ch,
+		// the library blocks the connection while a notification is not received, so they are buffered
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 128)),
+		returns:  ch.NotifyReturn(make(chan amqp.Return, 128)),
+		pending:  map[uint64]*Confirmation{},
+		returned: map[uint64]amqp.Return{},
+	}
+	go cc.run()
+	return cc
+}
+
+func (cc *confirmer) publish(exchange, key string, mandatory bool, msg amqp.Publishing) (*Confirmation, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	tag := cc.ch.GetNextPublishSeqNo()
+	if mandatory {
+		headers := make(amqp.Table, len(msg.Headers)+1)
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		headers[publishTagHeader] = int64(tag)
+		msg.Headers = headers
+	}
+
+	confirmation := newConfirmation()
+	cc.pending[tag] = confirmation
+	err := cc.ch.Publish(exchange, key, mandatory, false, msg)
+	if err != nil {
+		delete(cc.pending, tag)
+		return nil, err
+	}
+	return confirmation, nil
+}
+
+func (cc *confirmer) run() {
+	for confirmation := range cc.confirms {
+		// a return is always sent by the broker before the ack of its message
+		cc.drainReturns()
+
+		cc.mu.Lock()
+		c, found := cc.pending[confirmation.DeliveryTag]
+		delete(cc.pending, confirmation.DeliveryTag)
+		ret, returned := cc.returned[confirmation.DeliveryTag]
+		delete(cc.returned, confirmation.DeliveryTag)
+		cc.mu.Unlock()
+
+		if !found {
+			continue
+		}
+		switch {
+		case !confirmation.Ack:
+			c.resolve(ErrNacked)
+		case returned:
+			c.resolve(&ReturnError{Return: ret})
+		default:
+			c.resolve(nil)
+		}
+	}
+
+	// the channel is closed
+	cc.mu.Lock()
+	pending := cc.pending
+	cc.pending = map[uint64]*Confirmation{}
+	cc.mu.Unlock()
+	for _, c := range pending {
+		c.resolve(ErrChannelClosed)
+	}
+}
+
+func (cc *confirmer) drainReturns() {
+	for {
+		select {
+		case ret, ok := <-cc.returns:
+			if !ok {
+				return
+			}
+			tag, ok := ret.Headers[publishTagHeader].(int64)
+			if !ok {
+				log.Warn("rabbitmq message to exchange [", ret.Exchange, "] with key [", ret.RoutingKey, "] is returned: ", ret.ReplyText)
+				continue
+			}
+			cc.mu.Lock()
+			cc.returned[uint64(tag)] = ret
+			cc.mu.Unlock()
+		default:
+			return
+		}
+	}
+}
+
+// PublishAsync sends msg through a channel in confirm mode and returns without waiting for the broker,
+// the Confirmation tells whether the broker has taken msg. A mandatory msg which can not be routed to
+// any queue is returned by the broker, then the confirmation fails with a *ReturnError.
+func (c *Connection) PublishAsync(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (*Confirmation, error) {
+	pc, err := c.confirmPool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation, err := pc.confirmer.publish(exchange, key, mandatory, msg)
+	c.confirmPool.put(pc, err)
+	if err != nil {
+		return nil, err
+	}
+	return confirmation, nil
+}
+
+// PublishWithConfirm is PublishAsync which waits for the confirmation of the broker until ctx is done.
+func (c *Connection) PublishWithConfirm(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	confirmation, err := c.PublishAsync(ctx, exchange, key, mandatory, msg)
+	if err != nil {
+		return err
+	}
+	return confirmation.Wait(ctx)
+}
@@ -0,0 +1,125 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfirmation_Wait(t *testing.T) {
+	cases := []struct {
+		err      error
+		resolve  bool
+		expected error
+	}{
+		{resolve: true},
+		{err: ErrNacked, resolve: true, expected: ErrNacked},
+		{resolve: false, expected: context.DeadlineExceeded},
+	}
+
+	for i, c := range cases {
+		confirmation := newConfirmation()
+		if c.resolve {
+			confirmation.resolve(c.err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		if e, a := c.expected, confirmation.Wait(ctx); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		cancel()
+	}
+}
+
+func TestWithoutPublishTag(t *testing.T) {
+	headers := amqp.Table{"foo": "bar", publishTagHeader: int64(1)}
+	cases := []struct {
+		delivery amqp.Delivery
+		expected amqp.Table
+	}{
+		{delivery: amqp.Delivery{Headers: headers}, expected: amqp.Table{"foo": "bar"}},
+		{delivery: amqp.Delivery{Headers: amqp.Table{"foo": "bar"}}, expected: amqp.Table{"foo": "bar"}},
+		{delivery: amqp.Delivery{}, expected: nil},
+	}
+
+	for i, c := range cases {
+		if e, a := c.expected, withoutPublishTag(c.delivery).Headers; !reflect.DeepEqual(e, a) {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+	// the delivery is not modified
+	if _, found := headers[publishTagHeader]; !found {
+		t.Errorf("expected the headers of the delivery to be kept")
+	}
+}
+
+func TestConnection_PublishWithConfirm(t *testing.T) {
+	c := newTestConnection(t)
+
+	queue := fmt.Sprintf("sdk-go-test-confirm-%d", time.Now().UnixNano())
+	_, err := c.DeclareQueue(Queue{Name: queue, AutoDelete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		key            string
+		mandatory      bool
+		expectedReturn bool
+	}{
+		{key: queue, mandatory: true},
+		{key: queue + "-missing", mandatory: false},
+		{key: queue + "-missing", mandatory: true, expectedReturn: true},
+	}
+
+	for i, c2 := range cases {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		err := c.PublishWithConfirm(ctx, "", c2.key, c2.mandatory, amqp.Publishing{
+			Body:    []byte("confirm"),
+			Headers: amqp.Table{"foo": "bar"},
+		})
+		cancel()
+
+		var returnErr *ReturnError
+		if e, a := c2.expectedReturn, errors.As(err, &returnErr); e != a {
+			t.Errorf("case %d, expected a return %v, but received %v", i, e, err)
+		}
+		if !c2.expectedReturn && err != nil {
+			t.Errorf("case %d, unexpected error %v", i, err)
+		}
+		if returnErr != nil && returnErr.Return.RoutingKey != c2.key {
+			t.Errorf("case %d, expected %v, but received %v", i, c2.key, returnErr.Return.RoutingKey)
+		}
+	}
+}
+
+func TestConnection_PublishAsync(t *testing.T) {
+	c := newTestConnection(t, WithChannelPoolSize(2))
+
+	queue := fmt.Sprintf("sdk-go-test-confirm-async-%d", time.Now().UnixNano())
+	_, err := c.DeclareQueue(Queue{Name: queue, AutoDelete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var confirmations []*Confirmation
+	for i := 0; i < 100; i++ {
+		confirmation, err := c.PublishAsync(context.TODO(), "", queue, true, amqp.Publishing{Body: []byte("async")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		confirmations = append(confirmations, confirmation)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for i, confirmation := range confirmations {
+		if err := confirmation.Wait(ctx); err != nil {
+			t.Errorf("message %d, unexpected error %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package rabbitMQ
+
+import (
+	"context"
+	"github.com/hxy1991/sdk-go/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"time"
+)
+
+// Consume delivers the messages of queue until ctx is done or the connection is closed, the returned
+// channel is closed then. The consumer is subscribed again after every reconnection, the messages which
+// were not acknowledged before the connection was lost are redelivered by the broker.
+func (c *Connection) Consume(ctx context.Context, queue string) (<-chan amqp.Delivery, error) {
+	ch, deliveries, err := c.subscribe(queue, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan amqp.Delivery)
+	go c.forward(ctx, queue, ch, deliveries, out)
+
+	log.With("queueName", queue).Info("consumer is waiting")
+	return out, nil
+}
+
+// subscribe consumes queue on a new channel, prefetch 0 is unlimited and an empty tag is generated by the library.
+func (c *Connection) subscribe(queue string, prefetch int, tag string) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if prefetch > 0 {
+		err = ch.Qos(prefetch, 0, false)
+		if err != nil {
+			_ = ch.Close()
+			return nil, nil, err
+		}
+	}
+
+	deliveries, err := ch.Consume(queue, tag, false, false, false, false, nil)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, err
+	}
+	return ch, deliveries, nil
+}
+
+// forward passes the deliveries to out, and subscribes again whenever the channel is closed.
+func (c *Connection) forward(ctx context.Context, queue string, ch *amqp.Channel, deliveries <-chan amqp.Delivery, out chan<- amqp.Delivery) {
+	defer close(out)
+
+	for {
+		if !c.pump(ctx, deliveries, out) {
+			// cancels the consumer, the unacknowledged messages are requeued
+			_ = ch.Close()
+			return
+		}
+
+		// the channel or the connection was closed
+		var err error
+		ch, deliveries, err = c.resubscribe(ctx, queue, 0, "")
+		if err != nil {
+			return
+		}
+	}
+}
+
+// resubscribe subscribes again once the connection is usable, with backoff, until ctx is done
+// or the connection is closed.
+func (c *Connection) resubscribe(ctx context.Context, queue string, prefetch int, tag string) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	backoff := c.minReconnectBackoff
+	for {
+		_, err := c.wait(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ch, deliveries, err := c.subscribe(queue, prefetch, tag)
+		if err == nil {
+			log.With("queueName", queue).Info("consumer is resubscribed")
+			return ch, deliveries, nil
+		}
+		log.With("queueName", queue).Error("resubscribe consumer error ", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-c.done:
+			return nil, nil, ErrClosed
+		case <-time.After(backoff):
+		}
+		backoff = nextBackoff(backoff, c.maxReconnectBackoff)
+	}
+}
+
+// pump passes the deliveries to out until deliveries is closed, it returns false once ctx is done
+// or the connection is closed.
+func (c *Connection) pump(ctx context.Context, deliveries <-chan amqp.Delivery, out chan<- amqp.Delivery) bool {
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				return true
+			}
+			select {
+			case out <- withoutPublishTag(d):
+			case <-ctx.Done():
+				return false
+			case <-c.done:
+				return false
+			}
+		case <-ctx.Done():
+			return false
+		case <-c.done:
+			return false
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hxy1991/sdk-go/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrConsumerStarted = errors.New("rabbitmq: consumer is already started")
+
+// Handler handles a message, which is acknowledged once it returns nil, and retried or dead lettered
+// if it returns an error, see WithRetry, Permanent and Requeue. It must not acknowledge the message itself.
+// A panic is recovered and handled as an error. ctx is canceled when Shutdown gives up waiting for the handlers.
+type Handler func(ctx context.Context, d amqp.Delivery) error
+
+// Middleware wraps a Handler, e.g. to log, trace or recover from panics.
+type Middleware func(next Handler) Handler
+
+// Chain wraps handler with the middlewares, the first one is the outermost.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Consumer handles the messages of a queue with a number of workers, it survives reconnections.
+type Consumer struct {
+	c        *Connection
+	queue    string
+	tag      string
+	handler  Handler
+	prefetch int
+	workers  int
+
+	maxAttempts     int
+	minRetryBackoff time.Duration
+	maxRetryBackoff time.Duration
+	deadLetterQueue string
+
+	mu      sync.Mutex
+	started bool
+	// stopCtx is canceled by Shutdown to stop consuming
+	stopCtx context.Context
+	stop    context.CancelFunc
+	// handlerCtx is passed to the handlers, it is canceled when Shutdown gives up waiting
+	handlerCtx   context.Context
+	stopHandlers context.CancelFunc
+	done         chan struct{}
+}
+
+type consumerConfig struct {
+	prefetch    int
+	workers     int
+	bindings    []Binding
+	middlewares []Middleware
+
+	maxAttempts     int
+	minRetryBackoff time.Duration
+	maxRetryBackoff time.Duration
+	deadLetterQueue string
+}
+
+type ConsumerOption interface {
+	apply(*consumerConfig)
+}
+
+type consumerOptionFunc func(*consumerConfig)
+
+func (f consumerOptionFunc) apply(cfg *consumerConfig) {
+	f(cfg)
+}
+
+// WithPrefetch limits the number of unacknowledged messages sent by the broker, the default is
+// the number of workers.
+func WithPrefetch(prefetch int) ConsumerOption {
+	return consumerOptionFunc(func(cfg *consumerConfig) {
+		cfg.prefetch = prefetch
+	})
+}
+
+// WithWorkers sets the number of messages handled at the same time, the default is 1.
+func WithWorkers(workers int) ConsumerOption {
+	return consumerOptionFunc(func(cfg *consumerConfig) {
+		if workers > 0 {
+			cfg.workers = workers
+		}
+	})
+}
+
+// WithBinding binds the queue to the exchange with the routing key, or with the headers of args
+// for a headers exchange. It may be given several times.
+func WithBinding(exchange, key string, args amqp.Table) ConsumerOption {
+	return consumerOptionFunc(func(cfg *consumerConfig) {
+		cfg.bindings = append(cfg.bindings, Binding{Exchange: exchange, Key: key, Args: args})
+	})
+}
+
+// WithMiddleware wraps the handler with the middlewares, the first one is the outermost.
+func WithMiddleware(middlewares ...Middleware) ConsumerOption {
+	return consumerOptionFunc(func(cfg *consumerConfig) {
+		cfg.middlewares = append(cfg.middlewares, middlewares...)
+	})
+}
+
+// WithRetry retries a failed message until maxAttempts, the first retry is after minBackoff, which doubles
+// after every attempt up to maxBackoff. The messages wait in a queue per backoff, see RetryQueueName.
+// The default is no retry.
+func WithRetry(maxAttempts int, minBackoff, maxBackoff time.Duration) ConsumerOption {
+	return consumerOptionFunc(func(cfg *consumerConfig) {
+		cfg.maxAttempts = maxAttempts
+		cfg.minRetryBackoff = minBackoff
+		cfg.maxRetryBackoff = maxBackoff
+		if cfg.maxRetryBackoff < cfg.minRetryBackoff {
+			cfg.maxRetryBackoff = cfg.minRetryBackoff
+		}
+	})
+}
+
+// WithDeadLetterQueue sends the messages failed at their last attempt to the durable queue, with the
+// error, the attempts, the queue and the time of the failure in the headers. The default is to reject them, so that the broker dead letters them
+// if the queue has a x-dead-letter-exchange, or drops them.
+func WithDeadLetterQueue(queue string) ConsumerOption {
+	return consumerOptionFunc(func(cfg *consumerConfig) {
+		cfg.deadLetterQueue = queue
+	})
+}
+
+// NewConsumer declares the queue and its bindings, then Start begins consuming it.
+func NewConsumer(c *Connection, queue Queue, handler Handler, opts ...ConsumerOption) (*Consumer, error) {
+	cfg := &consumerConfig{
+		workers:     1,
+		maxAttempts: 1,
+	}
+	for _, opt := range opts {
+		opt.apply(cfg)
+	}
+	if cfg.prefetch <= 0 {
+		cfg.prefetch = cfg.workers
+	}
+
+	q, err := c.DeclareQueue(queue)
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range cfg.bindings {
+		binding.Queue = q.Name
+		err = c.BindQueue(binding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = declareRetry(c, queue, q.Name, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	stopCtx, stop := context.WithCancel(context.Background())
+	handlerCtx, stopHandlers := context.WithCancel(context.Background())
+	return &Consumer{
+		c:        c,
+		queue:    q.Name,
+		tag:      consumerTag(q.Name),
+		handler:  Chain(handler, cfg.middlewares...),
+		prefetch: cfg.prefetch,
+		workers:  cfg.workers,
+
+		maxAttempts:     cfg.maxAttempts,
+		minRetryBackoff: cfg.minRetryBackoff,
+		maxRetryBackoff: cfg.maxRetryBackoff,
+		deadLetterQueue: cfg.deadLetterQueue,
+
+		stopCtx:      stopCtx,
+		stop:         stop,
+		handlerCtx:   handlerCtx,
+		stopHandlers: stopHandlers,
+		done:         make(chan struct{}),
+	}, nil
+}
+
+var consumerSeq uint64
+
+// consumerTag is unique in the connection, so that the consumer can be canceled by its tag.
+func consumerTag(queue string) string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%s-%d-%d", queue, hostname, os.Getpid(), atomic.AddUint64(&consumerSeq, 1))
+}
+
+// Queue returns the name of the queue, which is given by the broker if it was declared without a name.
+func (cs *Consumer) Queue() string {
+	return cs.queue
+}
+
+// Start subscribes to the queue and returns, the messages are handled in the background.
+func (cs *Consumer) Start() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.started {
+		return ErrConsumerStarted
+	}
+	ch, deliveries, err := cs.c.subscribe(cs.queue, cs.prefetch, cs.tag)
+	if err != nil {
+		return err
+	}
+	cs.started = true
+
+	go cs.run(ch, deliveries)
+
+	log.With("queueName", cs.queue, "workers", cs.workers, "prefetch", cs.prefetch).Info("consumer is started")
+	return nil
+}
+
+// Shutdown stops receiving messages, then waits for the handlers to finish the messages received already.
+// If ctx is done first, the ctx of the handlers is canceled and ctx.Err() is returned, the messages which
+// are not acknowledged are redelivered by the broker.
+func (cs *Consumer) Shutdown(ctx context.Context) error {
+	cs.mu.Lock()
+	started := cs.started
+	cs.mu.Unlock()
+
+	cs.stop()
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-cs.done:
+		return nil
+	case <-ctx.Done():
+		cs.stopHandlers()
+		return ctx.Err()
+	}
+}
+
+func (cs *Consumer) run(ch *amqp.Channel, deliveries <-chan amqp.Delivery) {
+	defer close(cs.done)
+
+	jobs := make(chan amqp.Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < cs.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				cs.handle(cs.handlerCtx, d)
+			}
+		}()
+	}
+
+	for !cs.dispatch(ch, deliveries, jobs) {
+		// the channel or the connection was closed
+		var err error
+		ch, deliveries, err = cs.c.resubscribe(cs.stopCtx, cs.queue, cs.prefetch, cs.tag)
+		if err != nil {
+			ch = nil
+			break
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	// the handlers may acknowledge their messages until here
+	if ch != nil {
+		_ = ch.Close()
+	}
+	log.With("queueName", cs.queue).Info("consumer is stopped")
+}
+
+// handle calls the handler and settles d, a panic is recovered for d only.
+func (cs *Consumer) handle(ctx context.Context, d amqp.Delivery) {
+	err := cs.call(ctx, d)
+	cs.settle(ctx, d, err)
+}
+
+func (cs *Consumer) call(ctx context.Context, d amqp.Delivery) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			log.Context(ctx).With("queueName", cs.queue).Errorf("rabbitmq handler panic: %v\n%s", e, debug.Stack())
+			err = fmt.Errorf("rabbitmq handler panic: %v", e)
+		}
+	}()
+
+	return cs.handler(ctx, d)
+}
+
+// dispatch passes the deliveries to the workers until the channel is closed, it returns true once
+// the consumer is stopped and the messages received already are dispatched, or the connection is closed.
+func (cs *Consumer) dispatch(ch *amqp.Channel, deliveries <-chan amqp.Delivery, jobs chan<- amqp.Delivery) bool {
+	stopping := cs.stopCtx.Done()
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				// deliveries is closed after the consumer is canceled, or the channel is closed
+				return stopping == nil || cs.stopCtx.Err() != nil
+			}
+			select {
+			case jobs <- withoutPublishTag(d):
+			case <-cs.c.done:
+				return true
+			}
+		case <-stopping:
+			// 停止接收新消息，已收到的消息继续处理
+			err := ch.Cancel(cs.tag, false)
+			if err != nil {
+				return true
+			}
+			stopping = nil
+		case <-cs.c.done:
+			return true
+		}
+	}
+}
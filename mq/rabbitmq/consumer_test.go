@@ -0,0 +1,139 @@
+package rabbitMQ
+
+import (
+	"context"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConsumer_ShutdownBeforeStart(t *testing.T) {
+	cs := &Consumer{}
+	cs.stopCtx, cs.stop = context.WithCancel(context.Background())
+
+	if err := cs.Shutdown(context.TODO()); err != nil {
+		t.Errorf("expected %v, but received %v", nil, err)
+	}
+}
+
+func TestConsumer_Workers(t *testing.T) {
+	c := newTestConnection(t)
+
+	name := fmt.Sprintf("sdk-go-test-consumer-%d", time.Now().UnixNano())
+	p, err := NewProducer(c, Exchange{Name: name, Kind: amqp.ExchangeTopic, AutoDelete: true}, WithConfirm())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, messages = 4, 20
+	var handling, maxHandling, handled int32
+	var wg sync.WaitGroup
+	wg.Add(messages)
+	cs, err := NewConsumer(c, Queue{Name: name, AutoDelete: true}, func(ctx context.Context, d amqp.Delivery) error {
+		defer wg.Done()
+		n := atomic.AddInt32(&handling, 1)
+		for {
+			m := atomic.LoadInt32(&maxHandling)
+			if n <= m || atomic.CompareAndSwapInt32(&maxHandling, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 50)
+		atomic.AddInt32(&handling, -1)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}, WithWorkers(workers), WithBinding(name, "order.#", nil), WithMiddleware(Recover(), Logging()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Start(); err != ErrConsumerStarted {
+		t.Errorf("expected %v, but received %v", ErrConsumerStarted, err)
+	}
+
+	for i := 0; i < messages; i++ {
+		err := p.Publish(context.TODO(), "order.created", amqp.Publishing{Body: []byte("consumer")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if e, a := int32(workers), atomic.LoadInt32(&maxHandling); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := cs.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e, a := int32(messages), atomic.LoadInt32(&handled); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestConsumer_ShutdownDrains(t *testing.T) {
+	c := newTestConnection(t)
+
+	name := fmt.Sprintf("sdk-go-test-consumer-drain-%d", time.Now().UnixNano())
+	started := make(chan struct{}, 10)
+	var handled int32
+	cs, err := NewConsumer(c, Queue{Name: name}, func(ctx context.Context, d amqp.Delivery) error {
+		started <- struct{}{}
+		time.Sleep(time.Millisecond * 200)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}, WithWorkers(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err := c.PublishWithConfirm(context.TODO(), "", name, true, amqp.Publishing{Body: []byte("drain")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-started
+	<-started
+
+	// the in-flight messages are acknowledged before Shutdown returns
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := cs.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e, a := int32(2), atomic.LoadInt32(&handled); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	assertMessages(t, c, name, 0)
+}
+
+// assertMessages checks the number of the ready messages of queue, then deletes queue.
+func assertMessages(t *testing.T, c *Connection, queue string, expected int) {
+	t.Helper()
+
+	err := c.WithChannel(context.TODO(), func(ch *amqp.Channel) error {
+		q, err := ch.QueueInspect(queue)
+		if err != nil {
+			return err
+		}
+		if e, a := expected, q.Messages; e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		_, err = ch.QueueDelete(queue, false, false, false)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
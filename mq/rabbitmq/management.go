@@ -0,0 +1,153 @@
+package rabbitMQ
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultManagementTimeout = time.Second * 5
+
+// ManagementClient reads the numbers of the broker from the HTTP API of its management plugin, which are
+// richer than those of the AMQP protocol, e.g. the unacknowledged messages and the rates.
+type ManagementClient struct {
+	baseURL  string
+	username string
+	password string
+	vhost    string
+	client   *http.Client
+}
+
+// ManagementOption configures a ManagementClient.
+type ManagementOption interface {
+	apply(*ManagementClient)
+}
+
+type managementOptionFunc func(*ManagementClient)
+
+func (f managementOptionFunc) apply(m *ManagementClient) {
+	f(m)
+}
+
+// WithManagementVhost is the virtual host of the queues, the default is /.
+func WithManagementVhost(vhost string) ManagementOption {
+	return managementOptionFunc(func(m *ManagementClient) {
+		m.vhost = vhost
+	})
+}
+
+// WithHTTPClient sends the requests with client, the default has a timeout of 5 seconds.
+func WithHTTPClient(client *http.Client) ManagementOption {
+	return managementOptionFunc(func(m *ManagementClient) {
+		if client != nil {
+			m.client = client
+		}
+	})
+}
+
+// NewManagementClient returns a client of the management API at baseURL, e.g. http://localhost:15672.
+func NewManagementClient(baseURL, username, password string, opts ...ManagementOption) *ManagementClient {
+	m := &ManagementClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: username,
+		password: password,
+		vhost:    "/",
+		client:   &http.Client{Timeout: defaultManagementTimeout},
+	}
+
+	for _, opt := range opts {
+		opt.apply(m)
+	}
+
+	return m
+}
+
+// QueueInfo is a queue of the management API, only the common fields are decoded.
+type QueueInfo struct {
+	Name                   string  `json:"name"`
+	Vhost                  string  `json:"vhost"`
+	State                  string  `json:"state"`
+	Messages               int64   `json:"messages"`
+	MessagesReady          int64   `json:"messages_ready"`
+	MessagesUnacknowledged int64   `json:"messages_unacknowledged"`
+	Consumers              int64   `json:"consumers"`
+	ConsumerUtilisation    float64 `json:"consumer_utilisation"`
+	// Memory is in bytes
+	Memory       int64        `json:"memory"`
+	MessageStats MessageStats `json:"message_stats"`
+}
+
+// MessageStats are the counters of a queue since it was declared, with their rates per second.
+type MessageStats struct {
+	Publish           int64 `json:"publish"`
+	PublishDetails    Rate  `json:"publish_details"`
+	DeliverGet        int64 `json:"deliver_get"`
+	DeliverGetDetails Rate  `json:"deliver_get_details"`
+	Ack               int64 `json:"ack"`
+	AckDetails        Rate  `json:"ack_details"`
+	Redeliver         int64 `json:"redeliver"`
+	RedeliverDetails  Rate  `json:"redeliver_details"`
+}
+
+// Rate is the rate per second of a counter of MessageStats.
+type Rate struct {
+	Rate float64 `json:"rate"`
+}
+
+// ManagementError is the error of a request which the management API answered with a status other than 200.
+type ManagementError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ManagementError) Error() string {
+	return fmt.Sprintf("rabbitmq management api status %d: %s", e.StatusCode, e.Body)
+}
+
+// NotFound returns whether the queue or the virtual host does not exist.
+func (e *ManagementError) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+// Queue returns the queue of name, the error is a *ManagementError which is NotFound if there is none.
+func (m *ManagementClient) Queue(ctx context.Context, name string) (QueueInfo, error) {
+	var queue QueueInfo
+	err := m.get(ctx, "/api/queues/"+url.PathEscape(m.vhost)+"/"+url.PathEscape(name), &queue)
+	return queue, err
+}
+
+// Queues returns all the queues of the virtual host.
+func (m *ManagementClient) Queues(ctx context.Context) ([]QueueInfo, error) {
+	var queues []QueueInfo
+	err := m.get(ctx, "/api/queues/"+url.PathEscape(m.vhost), &queues)
+	return queues, err
+}
+
+func (m *ManagementClient) get(ctx context.Context, path string, v interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, m.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(m.username, m.password)
+	request.Header.Set("Accept", "application/json")
+
+	response, err := m.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return &ManagementError{StatusCode: response.StatusCode, Body: string(body)}
+	}
+	return json.Unmarshal(body, v)
+}
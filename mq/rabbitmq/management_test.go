@@ -0,0 +1,69 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManagementClient_Queue(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "guest" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/queues/%2F/orders_consumer":
+			_, _ = w.Write([]byte(`{"name":"orders_consumer","vhost":"/","state":"running","messages":3,"messages_ready":2,"messages_unacknowledged":1,"consumers":4,"message_stats":{"ack":7,"ack_details":{"rate":1.5}}}`))
+		case "/api/queues/%2F":
+			_, _ = w.Write([]byte(`[{"name":"a"},{"name":"b"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"Object Not Found","reason":"Not Found"}`))
+		}
+	}))
+	defer s.Close()
+
+	ctx := context.TODO()
+	m := NewManagementClient(s.URL+"/", "guest", "secret")
+
+	queue, err := m.Queue(ctx, "orders_consumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := QueueInfo{
+		Name:                   "orders_consumer",
+		Vhost:                  "/",
+		State:                  "running",
+		Messages:               3,
+		MessagesReady:          2,
+		MessagesUnacknowledged: 1,
+		Consumers:              4,
+		MessageStats:           MessageStats{Ack: 7, AckDetails: Rate{Rate: 1.5}},
+	}
+	if queue != e {
+		t.Errorf("expected %v, but received %v", e, queue)
+	}
+
+	queues, err := m.Queues(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 2, len(queues); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	_, err = m.Queue(ctx, "missing")
+	var managementErr *ManagementError
+	if !errors.As(err, &managementErr) || !managementErr.NotFound() {
+		t.Errorf("expected a not found error, but received %v", err)
+	}
+
+	_, err = NewManagementClient(s.URL, "guest", "wrong").Queue(ctx, "orders_consumer")
+	if !errors.As(err, &managementErr) || managementErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an unauthorized error, but received %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package rabbitMQ
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/hxy1991/sdk-go/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"runtime/debug"
+	"time"
+)
+
+// Recover turns the panic of a handler into an error and logs its stack, so that the middlewares
+// around it see the failure. The Consumer recovers the panics anyway.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, d amqp.Delivery) (err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					log.Context(ctx).
+						With("exchange", d.Exchange, "routingKey", d.RoutingKey, "messageId", d.MessageId).
+						Errorf("rabbitmq handler panic: %v\n%s", e, debug.Stack())
+					err = fmt.Errorf("rabbitmq handler panic: %v", e)
+				}
+			}()
+
+			return next(ctx, d)
+		}
+	}
+}
+
+// Logging logs every message with the latency and the error of its handler.
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, d amqp.Delivery) (err error) {
+			startTime := time.Now()
+			defer func() {
+				duration := time.Now().Sub(startTime)
+				log.Context(ctx).
+					With("exchange", d.Exchange, "routingKey", d.RoutingKey).
+					With("messageId", d.MessageId, "redelivered", d.Redelivered, "attempt", Attempts(d)).
+					With("error", err).
+					With("latency", fmt.Sprintf("%13v", duration)).
+					With("latencyInNS", duration.Nanoseconds()).
+					Debug()
+			}()
+
+			return next(ctx, d)
+		}
+	}
+}
+
+// Tracing handles every message in a new X-Ray segment of the name.
+func Tracing(name string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, d amqp.Delivery) (err error) {
+			if xray.SdkDisabled() {
+				return next(ctx, d)
+			}
+
+			_ctx, segment := xray.BeginSegment(ctx, name)
+			_ = segment.AddAnnotation("exchange", d.Exchange)
+			_ = segment.AddAnnotation("routingKey", d.RoutingKey)
+			_ = segment.AddAnnotation("attempt", Attempts(d))
+			if d.MessageId != "" {
+				_ = segment.AddAnnotation("messageId", d.MessageId)
+			}
+
+			// panic 时 segment 标记为 fault，再交给外层处理
+			defer func() {
+				if e := recover(); e != nil {
+					segment.Close(fmt.Errorf("panic: %v", e))
+					panic(e)
+				}
+				segment.Close(err)
+			}()
+
+			return next(_ctx, d)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// acknowledger records the acknowledgements of the deliveries of a test.
+type acknowledger struct {
+	mu      sync.Mutex
+	acks    []uint64
+	nacks   []uint64
+	requeue []bool
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acks = append(a.acks, tag)
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nacks = append(a.nacks, tag)
+	a.requeue = append(a.requeue, requeue)
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, d amqp.Delivery) error {
+				calls = append(calls, name)
+				return next(ctx, d)
+			}
+		}
+	}
+
+	handler := Chain(func(ctx context.Context, d amqp.Delivery) error {
+		calls = append(calls, "handler")
+		return nil
+	}, middleware("first"), middleware("second"))
+	_ = handler(context.TODO(), amqp.Delivery{})
+
+	if e, a := []string{"first", "second", "handler"}, calls; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	failure := errors.New("failure")
+	cases := []struct {
+		handler  Handler
+		expected string
+	}{
+		{
+			handler:  func(ctx context.Context, d amqp.Delivery) error { return nil },
+			expected: "",
+		},
+		{
+			handler:  func(ctx context.Context, d amqp.Delivery) error { return failure },
+			expected: "failure",
+		},
+		{
+			handler:  func(ctx context.Context, d amqp.Delivery) error { panic("boom") },
+			expected: "rabbitmq handler panic: boom",
+		},
+	}
+
+	for i, c := range cases {
+		err := Chain(c.handler, Recover(), Logging(), Tracing("test"))(context.TODO(), amqp.Delivery{})
+
+		var a string
+		if err != nil {
+			a = err.Error()
+		}
+		if e := c.expected; e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
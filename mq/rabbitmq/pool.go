@@ -0,0 +1,153 @@
+package rabbitMQ
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"sync"
+)
+
+const defaultChannelPoolSize = 16
+
+// channelPool bounds the number of channels borrowed at the same time, and keeps the returned ones
+// open for the next borrower. A channel which was closed, or belongs to a lost connection, is discarded.
+type channelPool struct {
+	c *Connection
+	// confirm puts the channels in confirm mode
+	confirm bool
+	// tokens has one token per channel which may be borrowed
+	tokens chan struct{}
+
+	mu   sync.Mutex
+	idle []*pooledChannel
+}
+
+type pooledChannel struct {
+	ch   *amqp.Channel
+	conn *amqp.Connection
+	// confirmer is only set in confirm mode
+	confirmer *confirmer
+}
+
+func newChannelPool(c *Connection, size int, confirm bool) *channelPool {
+	return &channelPool{
+		c:       c,
+		confirm: confirm,
+		tokens:  make(chan struct{}, size),
+	}
+}
+
+// get borrows a channel, waiting for one to be returned if size channels are borrowed already.
+func (p *channelPool) get(ctx context.Context) (*pooledChannel, error) {
+	select {
+	case p.tokens <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	conn, err := p.c.current()
+	if err != nil {
+		<-p.tokens
+		return nil, err
+	}
+
+	for {
+		pc, ok := p.pop()
+		if !ok {
+			break
+		}
+		if pc.conn == conn && !pc.ch.IsClosed() {
+			return pc, nil
+		}
+		// 已关闭的 channel 直接丢弃
+		_ = pc.ch.Close()
+	}
+
+	pc, err := p.open(conn)
+	if err != nil {
+		<-p.tokens
+		return nil, err
+	}
+	return pc, nil
+}
+
+func (p *channelPool) open(conn *amqp.Connection) (*pooledChannel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &pooledChannel{ch: ch, conn: conn}
+	if p.confirm {
+		err = ch.Confirm(false)
+		if err != nil {
+			_ = ch.Close()
+			return nil, err
+		}
+		pc.confirmer = newConfirmer(ch)
+	}
+	return pc, nil
+}
+
+// put returns a channel borrowed by get, err is the error of its use, if any.
+func (p *channelPool) put(pc *pooledChannel, err error) {
+	defer func() {
+		<-p.tokens
+	}()
+
+	conn, currentErr := p.c.current()
+	if err != nil || currentErr != nil || pc.conn != conn || pc.ch.IsClosed() {
+		// the channel may be in any state after an error, e.g. closed by the broker
+		_ = pc.ch.Close()
+		return
+	}
+
+	p.mu.Lock()
+	p.idle = append(p.idle, pc)
+	p.mu.Unlock()
+}
+
+func (p *channelPool) pop() (*pooledChannel, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.idle)
+	if n == 0 {
+		return nil, false
+	}
+	pc := p.idle[n-1]
+	p.idle = p.idle[:n-1]
+	return pc, true
+}
+
+// clear drops the idle channels, e.g. because their connection was lost.
+func (p *channelPool) clear() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		_ = pc.ch.Close()
+	}
+}
+
+// WithChannel borrows a channel of the pool for fn, then returns it to the pool unless fn failed,
+// in which case the channel is closed. fn must not keep the channel or close it.
+func (c *Connection) WithChannel(ctx context.Context, fn func(ch *amqp.Channel) error) error {
+	pc, err := c.pool.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(pc.ch)
+	c.pool.put(pc, err)
+	return err
+}
+
+// Publish sends msg through a channel of the pool, it returns as soon as msg is written,
+// see PublishWithConfirm to know that the broker has got it.
+func (c *Connection) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	return c.WithChannel(ctx, func(ch *amqp.Channel) error {
+		return ch.Publish(exchange, key, false, false, msg)
+	})
+}
@@ -0,0 +1,133 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"testing"
+	"time"
+)
+
+func TestConnection_WithChannel(t *testing.T) {
+	c := newTestConnection(t, WithChannelPoolSize(2))
+
+	var first *amqp.Channel
+	err := c.WithChannel(context.TODO(), func(ch *amqp.Channel) error {
+		first = ch
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the returned channel is reused
+	err = c.WithChannel(context.TODO(), func(ch *amqp.Channel) error {
+		if ch != first {
+			t.Errorf("expected the pooled channel to be reused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed channel is discarded
+	failure := errors.New("failure")
+	err = c.WithChannel(context.TODO(), func(ch *amqp.Channel) error {
+		return failure
+	})
+	if err != failure {
+		t.Errorf("expected %v, but received %v", failure, err)
+	}
+	if !first.IsClosed() {
+		t.Errorf("expected the failed channel to be closed")
+	}
+
+	// a channel closed by the broker is discarded, here by declaring a queue with another type
+	queue := fmt.Sprintf("sdk-go-test-pool-%d", time.Now().UnixNano())
+	_, err = c.DeclareQueue(Queue{Name: queue, AutoDelete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var closed *amqp.Channel
+	_ = c.WithChannel(context.TODO(), func(ch *amqp.Channel) error {
+		closed = ch
+		_, err := ch.QueueDeclare(queue, true, false, false, false, nil)
+		return err
+	})
+	err = c.WithChannel(context.TODO(), func(ch *amqp.Channel) error {
+		if ch == closed {
+			t.Errorf("expected the closed channel to be discarded")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnection_WithChannelBounded(t *testing.T) {
+	c := newTestConnection(t, WithChannelPoolSize(1))
+
+	borrowed := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_ = c.WithChannel(context.TODO(), func(ch *amqp.Channel) error {
+			close(borrowed)
+			<-release
+			return nil
+		})
+	}()
+	<-borrowed
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	err := c.WithChannel(ctx, func(ch *amqp.Channel) error {
+		t.Errorf("expected to wait for the only channel")
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v, but received %v", context.DeadlineExceeded, err)
+	}
+	close(release)
+}
+
+func benchmarkPublish(b *testing.B, publish func(c *Connection, queue string, msg amqp.Publishing) error) {
+	c := newTestConnection(b)
+
+	queue := fmt.Sprintf("sdk-go-bench-pool-%d", time.Now().UnixNano())
+	_, err := c.DeclareQueue(Queue{Name: queue, AutoDelete: true, Args: amqp.Table{"x-max-length": 1000}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	msg := amqp.Publishing{Body: []byte("benchmark")}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := publish(c, queue, msg); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkPublish_NewChannel is how DelayQueue used to publish, with a channel per message.
+func BenchmarkPublish_NewChannel(b *testing.B) {
+	benchmarkPublish(b, func(c *Connection, queue string, msg amqp.Publishing) error {
+		ch, err := c.Channel()
+		if err != nil {
+			return err
+		}
+		defer ch.Close()
+		return ch.Publish("", queue, false, false, msg)
+	})
+}
+
+func BenchmarkPublish_Pooled(b *testing.B) {
+	benchmarkPublish(b, func(c *Connection, queue string, msg amqp.Publishing) error {
+		return c.Publish(context.TODO(), "", queue, msg)
+	})
+}
@@ -0,0 +1,92 @@
+package rabbitMQ
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Producer publishes to one exchange of any kind, the routing key is used by the direct and topic
+// exchanges, the headers of the message by the headers exchanges.
+type Producer struct {
+	c          *Connection
+	exchange   string
+	confirm    bool
+	mandatory  bool
+	persistent bool
+}
+
+type producerConfig struct {
+	confirm    bool
+	mandatory  bool
+	persistent bool
+}
+
+type ProducerOption interface {
+	apply(*producerConfig)
+}
+
+type producerOptionFunc func(*producerConfig)
+
+func (f producerOptionFunc) apply(cfg *producerConfig) {
+	f(cfg)
+}
+
+// WithConfirm makes Publish wait for the broker to confirm every message.
+func WithConfirm() ProducerOption {
+	return producerOptionFunc(func(cfg *producerConfig) {
+		cfg.confirm = true
+	})
+}
+
+// WithMandatory makes Publish fail with a *ReturnError when a message can not be routed to any queue,
+// it implies WithConfirm.
+func WithMandatory() ProducerOption {
+	return producerOptionFunc(func(cfg *producerConfig) {
+		cfg.confirm = true
+		cfg.mandatory = true
+	})
+}
+
+// WithPersistent sets the persistent delivery mode on every message, so that the messages
+// of durable queues survive a restart of the broker.
+func WithPersistent() ProducerOption {
+	return producerOptionFunc(func(cfg *producerConfig) {
+		cfg.persistent = true
+	})
+}
+
+// NewProducer declares the exchange, unless its name is empty which is the default exchange
+// routing to the queue named by the key.
+func NewProducer(c *Connection, exchange Exchange, opts ...ProducerOption) (*Producer, error) {
+	cfg := &producerConfig{}
+	for _, opt := range opts {
+		opt.apply(cfg)
+	}
+
+	if exchange.Name != "" {
+		err := c.DeclareExchange(exchange)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Producer{
+		c:          c,
+		exchange:   exchange.Name,
+		confirm:    cfg.confirm,
+		mandatory:  cfg.mandatory,
+		persistent: cfg.persistent,
+	}, nil
+}
+
+// Publish sends msg with the routing key, the key is ignored by the fanout and headers exchanges.
+func (p *Producer) Publish(ctx context.Context, key string, msg amqp.Publishing) error {
+	if p.persistent {
+		msg.DeliveryMode = amqp.Persistent
+	}
+
+	if p.confirm {
+		return p.c.PublishWithConfirm(ctx, p.exchange, key, p.mandatory, msg)
+	}
+	return p.c.Publish(ctx, p.exchange, key, msg)
+}
@@ -0,0 +1,75 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"testing"
+	"time"
+)
+
+func TestProducer_Publish(t *testing.T) {
+	c := newTestConnection(t)
+
+	name := fmt.Sprintf("sdk-go-test-producer-%d", time.Now().UnixNano())
+	cases := []struct {
+		exchange Exchange
+		binding  Binding
+		key      string
+		headers  amqp.Table
+		routed   bool
+	}{
+		{
+			exchange: Exchange{Name: name + ".direct", Kind: amqp.ExchangeDirect, AutoDelete: true},
+			binding:  Binding{Key: "created"},
+			key:      "created",
+			routed:   true,
+		},
+		{
+			exchange: Exchange{Name: name + ".topic", Kind: amqp.ExchangeTopic, AutoDelete: true},
+			binding:  Binding{Key: "order.*"},
+			key:      "order.created",
+			routed:   true,
+		},
+		{
+			exchange: Exchange{Name: name + ".topic2", Kind: amqp.ExchangeTopic, AutoDelete: true},
+			binding:  Binding{Key: "order.*"},
+			key:      "user.created",
+			routed:   false,
+		},
+		{
+			exchange: Exchange{Name: name + ".headers", Kind: amqp.ExchangeHeaders, AutoDelete: true},
+			binding:  Binding{Args: amqp.Table{"x-match": "all", "type": "order"}},
+			headers:  amqp.Table{"type": "order"},
+			routed:   true,
+		},
+	}
+
+	for i, c2 := range cases {
+		p, err := NewProducer(c, c2.exchange, WithMandatory(), WithPersistent())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		queue, err := c.DeclareQueue(Queue{Name: fmt.Sprintf("%s-%d", name, i), AutoDelete: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c2.binding.Queue = queue.Name
+		c2.binding.Exchange = c2.exchange.Name
+		err = c.BindQueue(c2.binding)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		err = p.Publish(ctx, c2.key, amqp.Publishing{Headers: c2.headers, Body: []byte("producer")})
+		cancel()
+
+		var returnErr *ReturnError
+		if e, a := !c2.routed, errors.As(err, &returnErr); e != a {
+			t.Errorf("case %d, expected a return %v, but received %v", i, e, err)
+		}
+	}
+}
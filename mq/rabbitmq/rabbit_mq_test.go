@@ -0,0 +1,162 @@
+package rabbitMQ
+
+import (
+	"context"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestConnection connects to the broker of the RABBITMQ_URL env, or to the local one,
+// and skips the test if there is no broker.
+func newTestConnection(t testing.TB, opts ...Option) *Connection {
+	opts = append([]Option{WithDialTimeout(time.Second)}, opts...)
+	c, err := New(opts...)
+	if err != nil {
+		t.Skip("rabbitmq is not available: ", err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c
+}
+
+// netConns records the network connections dialed by a Connection, so that a test can break them.
+type netConns struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (n *netConns) option() Option {
+	return optionFunc(func(cfg *config) error {
+		dial := amqp.DefaultDial(cfg.dialTimeout)
+		cfg.dial = func(network, addr string) (net.Conn, error) {
+			conn, err := dial(network, addr)
+			if err == nil {
+				n.mu.Lock()
+				n.conns = append(n.conns, conn)
+				n.mu.Unlock()
+			}
+			return conn, err
+		}
+		return nil
+	})
+}
+
+func (n *netConns) breakAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, conn := range n.conns {
+		_ = conn.Close()
+	}
+	n.conns = nil
+}
+
+func TestNextBackoff(t *testing.T) {
+	cases := []struct {
+		backoff  time.Duration
+		max      time.Duration
+		expected time.Duration
+	}{
+		{time.Second, time.Second * 30, time.Second * 2},
+		{time.Second * 20, time.Second * 30, time.Second * 30},
+		{time.Second * 30, time.Second * 30, time.Second * 30},
+	}
+
+	for i, c := range cases {
+		if e, a := c.expected, nextBackoff(c.backoff, c.max); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestConnection_Reconnect(t *testing.T) {
+	var conns netConns
+	events := make(chan ConnectionEvent, 10)
+	c := newTestConnection(t,
+		conns.option(),
+		WithReconnectBackoff(time.Millisecond*100, time.Second),
+		WithOnConnectionEvent(func(event ConnectionEvent) {
+			events <- event
+		}),
+	)
+
+	queue := fmt.Sprintf("sdk-go-test-reconnect-%d", time.Now().UnixNano())
+	_, err := c.DeclareQueue(Queue{Name: queue, AutoDelete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	deliveries, err := c.Consume(ctx, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conns.breakAll()
+
+	for _, expected := range []ConnectionEventType{Disconnected, Reconnected} {
+		select {
+		case event := <-events:
+			if e, a := expected, event.Type; e != a {
+				t.Fatalf("expected %v, but received %v", e, a)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatalf("expected %v event", expected)
+		}
+	}
+
+	// the auto delete queue was declared again and the consumer subscribed again
+	var ch *amqp.Channel
+	for i := 0; ; i++ {
+		ch, err = c.Channel()
+		if err == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	defer ch.Close()
+
+	err = ch.Publish("", queue, false, false, amqp.Publishing{Body: []byte("after reconnect")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case d := <-deliveries:
+		if e, a := "after reconnect", string(d.Body); e != a {
+			t.Errorf("expected %v, but received %v", e, a)
+		}
+		_ = d.Ack(false)
+	case <-time.After(time.Second * 10):
+		t.Fatal("expected a delivery after reconnecting")
+	}
+
+	cancel()
+	for range deliveries {
+	}
+}
+
+func TestConnection_Close(t *testing.T) {
+	c := newTestConnection(t)
+
+	err := c.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Channel(); err != ErrClosed {
+		t.Errorf("expected %v, but received %v", ErrClosed, err)
+	}
+	if _, err := c.Consume(context.TODO(), "any"); err != ErrClosed {
+		t.Errorf("expected %v, but received %v", ErrClosed, err)
+	}
+}
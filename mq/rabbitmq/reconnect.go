@@ -0,0 +1,135 @@
+package rabbitMQ
+
+import (
+	"fmt"
+	"github.com/hxy1991/sdk-go/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"time"
+)
+
+type ConnectionEventType int
+
+const (
+	// Disconnected means the connection to the broker was lost, Err is why
+	Disconnected ConnectionEventType = iota
+	// Reconnected means the connection, the topology and the consumers are back
+	Reconnected
+	// ReconnectFailed means an attempt to reconnect failed, the next one is made after a backoff
+	ReconnectFailed
+)
+
+func (t ConnectionEventType) String() string {
+	switch t {
+	case Disconnected:
+		return "disconnected"
+	case Reconnected:
+		return "reconnected"
+	case ReconnectFailed:
+		return "reconnect failed"
+	default:
+		return fmt.Sprintf("ConnectionEventType(%d)", int(t))
+	}
+}
+
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	// Attempt is the number of reconnect attempts since the connection was lost
+	Attempt int
+	Err     error
+}
+
+// dial connects to the broker and declares the known topology.
+func (c *Connection) dial() (*amqp.Connection, error) {
+	conn, err := amqp.DialConfig(c.address, c.amqpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.declareTopology(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// setConn makes conn the current connection and watches it, unless Close was called meanwhile.
+func (c *Connection) setConn(conn *amqp.Connection) bool {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		_ = conn.Close()
+		return false
+	}
+	c.conn = conn
+	close(c.ready)
+	c.mu.Unlock()
+
+	go c.watch(conn)
+	return true
+}
+
+// watch waits for conn to be closed and then reconnects, unless it was closed by Close.
+func (c *Connection) watch(conn *amqp.Connection) {
+	amqpErr, _ := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.conn = nil
+	c.ready = make(chan struct{})
+	c.mu.Unlock()
+
+	c.pool.clear()
+	c.confirmPool.clear()
+
+	var err error = amqp.ErrClosed
+	if amqpErr != nil {
+		err = amqpErr
+	}
+	log.Warn("rabbitmq connection to ", c.address, " is lost, reconnecting, ", err)
+	c.emit(ConnectionEvent{Type: Disconnected, Err: err})
+
+	c.reconnect()
+}
+
+func (c *Connection) reconnect() {
+	backoff := c.minReconnectBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		conn, err := c.dial()
+		if err != nil {
+			log.Error("rabbitmq reconnect to ", c.address, " error, attempt ", attempt, ", ", err)
+			c.emit(ConnectionEvent{Type: ReconnectFailed, Attempt: attempt, Err: err})
+			backoff = nextBackoff(backoff, c.maxReconnectBackoff)
+			continue
+		}
+
+		if c.setConn(conn) {
+			log.Info("rabbitmq reconnected to ", c.address, " after ", attempt, " attempts")
+			c.emit(ConnectionEvent{Type: Reconnected, Attempt: attempt})
+		}
+		return
+	}
+}
+
+func (c *Connection) emit(event ConnectionEvent) {
+	if c.onEvent != nil {
+		c.onEvent(event)
+	}
+}
+
+// nextBackoff doubles backoff up to max.
+func nextBackoff(backoff, max time.Duration) time.Duration {
+	if backoff *= 2; backoff > max {
+		return max
+	}
+	return backoff
+}
@@ -0,0 +1,244 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"github.com/hxy1991/sdk-go/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"strconv"
+	"time"
+)
+
+const (
+	// AttemptsHeader is the number of the attempt to handle a message, starting at 1.
+	AttemptsHeader = "x-sdk-attempts"
+	// ErrorHeader is the error of the last attempt of a dead lettered message.
+	ErrorHeader = "x-sdk-error"
+	// QueueHeader is the queue where a dead lettered message failed.
+	QueueHeader = "x-sdk-queue"
+	// FailedAtHeader is the time of the last attempt of a dead lettered message.
+	FailedAtHeader = "x-sdk-failed-at"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not worth retrying, the message is dead lettered at once.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns whether err was marked by Permanent.
+func IsPermanent(err error) bool {
+	var permanentErr *permanentError
+	return errors.As(err, &permanentErr)
+}
+
+type requeueError struct {
+	err error
+}
+
+func (e *requeueError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requeueError) Unwrap() error {
+	return e.err
+}
+
+// Requeue makes the broker requeue the message at once, and the attempt is not counted.
+// It suits errors which have nothing to do with the message, e.g. a dependency being restarted.
+func Requeue(err error) error {
+	return &requeueError{err: err}
+}
+
+// Attempts returns the number of the attempt to handle d, starting at 1.
+func Attempts(d amqp.Delivery) int {
+	switch v := d.Headers[AttemptsHeader].(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case int16:
+		return int(v)
+	case int8:
+		return int(v)
+	case int:
+		return v
+	}
+	return 1
+}
+
+// RetryQueueName is the name of the queue where the failed messages wait for backoff, then they are dead
+// lettered back to the queue. Every backoff has a queue of its own, as the broker only expires the messages
+// at the head of a queue.
+func RetryQueueName(queue string, backoff time.Duration) string {
+	return queue + ".retry." + strconv.FormatInt(backoff.Milliseconds(), 10)
+}
+
+// RetryQueueNames returns the retry queues of the queue consumed WithRetry(maxAttempts, minBackoff, maxBackoff).
+func RetryQueueNames(queue string, maxAttempts int, minBackoff, maxBackoff time.Duration) []string {
+	var names []string
+	for _, backoff := range retryBackoffs(maxAttempts, minBackoff, maxBackoff) {
+		names = append(names, RetryQueueName(queue, backoff))
+	}
+	return names
+}
+
+// retryBackoffs returns the distinct backoffs of the attempts before the last one.
+func retryBackoffs(maxAttempts int, min, max time.Duration) []time.Duration {
+	var backoffs []time.Duration
+	for attempt := 1; attempt < maxAttempts; attempt++ {
+		backoff := RetryBackoff(attempt, min, max)
+		if n := len(backoffs); n > 0 && backoffs[n-1].Milliseconds() == backoff.Milliseconds() {
+			// it stays at max from now on
+			break
+		}
+		backoffs = append(backoffs, backoff)
+	}
+	return backoffs
+}
+
+// RetryBackoff is the wait after the failed attempt, it doubles after every attempt up to max.
+func RetryBackoff(attempt int, min, max time.Duration) time.Duration {
+	backoff := min
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff = nextBackoff(backoff, max)
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// declareRetry declares the retry queues and the dead letter queue of the consumer if they are enabled.
+func declareRetry(c *Connection, queue Queue, name string, cfg *consumerConfig) error {
+	for _, backoff := range retryBackoffs(cfg.maxAttempts, cfg.minRetryBackoff, cfg.maxRetryBackoff) {
+		_, err := c.DeclareQueue(Queue{
+			Name:       RetryQueueName(name, backoff),
+			Durable:    queue.Durable,
+			AutoDelete: queue.AutoDelete,
+			Args: amqp.Table{
+				"x-message-ttl": backoff.Milliseconds(),
+				// 等待重试的消息过期后通过默认 exchange 回到原队列
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": name,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.deadLetterQueue != "" {
+		_, err := c.DeclareQueue(Queue{Name: cfg.deadLetterQueue, Durable: true})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settle acknowledges d according to the error of its handler: an ack on success, otherwise a retry
+// after the backoff until the last attempt, then the dead letter queue.
+func (cs *Consumer) settle(ctx context.Context, d amqp.Delivery, err error) {
+	if err == nil {
+		cs.ack(ctx, d)
+		return
+	}
+
+	attempt := Attempts(d)
+	logger := log.Context(ctx).With("queueName", cs.queue, "messageId", d.MessageId, "attempt", attempt)
+
+	var requeueErr *requeueError
+	if errors.As(err, &requeueErr) {
+		logger.Warn("handle message error, requeue it: ", err)
+		cs.nack(ctx, d, true)
+		return
+	}
+
+	if !IsPermanent(err) && attempt < cs.maxAttempts {
+		backoff := RetryBackoff(attempt, cs.minRetryBackoff, cs.maxRetryBackoff)
+		logger.Warn("handle message error, retry it after ", backoff, ": ", err)
+
+		msg := Republishing(d, amqp.Table{AttemptsHeader: int64(attempt + 1)})
+		cs.forward(ctx, d, RetryQueueName(cs.queue, backoff), msg)
+		return
+	}
+
+	logger.Error("handle message error, dead letter it: ", err)
+	if cs.deadLetterQueue == "" {
+		// 队列配置了 x-dead-letter-exchange 时由 broker 转发，否则丢弃
+		cs.nack(ctx, d, false)
+		return
+	}
+	// the timestamp of the message is kept as well
+	msg := Republishing(d, amqp.Table{
+		AttemptsHeader: int64(attempt),
+		ErrorHeader:    err.Error(),
+		QueueHeader:    cs.queue,
+		FailedAtHeader: time.Now(),
+	})
+	cs.forward(ctx, d, cs.deadLetterQueue, msg)
+}
+
+// forward publishes msg to queue, then acknowledges d, or requeues d if the broker did not take msg.
+func (cs *Consumer) forward(ctx context.Context, d amqp.Delivery, queue string, msg amqp.Publishing) {
+	err := cs.c.PublishWithConfirm(ctx, "", queue, true, msg)
+	if err != nil {
+		log.Context(ctx).With("queueName", queue).Error("forward message error, requeue it: ", err)
+		cs.nack(ctx, d, true)
+		return
+	}
+	cs.ack(ctx, d)
+}
+
+func (cs *Consumer) ack(ctx context.Context, d amqp.Delivery) {
+	err := d.Ack(false)
+	if err != nil {
+		log.Context(ctx).With("queueName", cs.queue).Error("ack message error ", err)
+	}
+}
+
+func (cs *Consumer) nack(ctx context.Context, d amqp.Delivery, requeue bool) {
+	err := d.Nack(false, requeue)
+	if err != nil {
+		log.Context(ctx).With("queueName", cs.queue).Error("nack message error ", err)
+	}
+}
+
+// Republishing copies d to publish it again, with the headers overridden by headers.
+func Republishing(d amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	table := make(amqp.Table, len(d.Headers)+len(headers))
+	for k, v := range d.Headers {
+		table[k] = v
+	}
+	for k, v := range headers {
+		table[k] = v
+	}
+
+	return amqp.Publishing{
+		Headers:         table,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
@@ -0,0 +1,168 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAttempts(t *testing.T) {
+	cases := []struct {
+		headers  amqp.Table
+		expected int
+	}{
+		{headers: nil, expected: 1},
+		{headers: amqp.Table{AttemptsHeader: int64(3)}, expected: 3},
+		{headers: amqp.Table{AttemptsHeader: int32(2)}, expected: 2},
+		{headers: amqp.Table{AttemptsHeader: "2"}, expected: 1},
+	}
+
+	for i, c := range cases {
+		if e, a := c.expected, Attempts(amqp.Delivery{Headers: c.headers}); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	cases := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 1, expected: time.Second},
+		{attempt: 2, expected: time.Second * 2},
+		{attempt: 3, expected: time.Second * 4},
+		{attempt: 10, expected: time.Second * 10},
+	}
+
+	for i, c := range cases {
+		if e, a := c.expected, RetryBackoff(c.attempt, time.Second, time.Second*10); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestRetryQueueNames(t *testing.T) {
+	cases := []struct {
+		maxAttempts int
+		min, max    time.Duration
+		expected    []string
+	}{
+		{maxAttempts: 1, min: time.Second, max: time.Second},
+		{maxAttempts: 3, min: time.Second, max: time.Second * 10, expected: []string{"q.retry.1000", "q.retry.2000"}},
+		{maxAttempts: 10, min: time.Second, max: time.Second * 3, expected: []string{"q.retry.1000", "q.retry.2000", "q.retry.3000"}},
+		{maxAttempts: 5, min: 0, max: 0, expected: []string{"q.retry.0"}},
+	}
+
+	for i, c := range cases {
+		if e, a := c.expected, RetryQueueNames("q", c.maxAttempts, c.min, c.max); !reflect.DeepEqual(e, a) {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestConsumer_Settle(t *testing.T) {
+	failure := errors.New("failure")
+	cases := []struct {
+		err             error
+		expectedAcks    int
+		expectedRequeue []bool
+	}{
+		{err: nil, expectedAcks: 1},
+		{err: failure, expectedRequeue: []bool{false}},
+		{err: Permanent(failure), expectedRequeue: []bool{false}},
+		{err: Requeue(failure), expectedRequeue: []bool{true}},
+	}
+
+	// without retry nor dead letter queue, nothing is published
+	cs := &Consumer{queue: "settle", maxAttempts: 1}
+	for i, c := range cases {
+		ack := &acknowledger{}
+		cs.settle(context.TODO(), amqp.Delivery{Acknowledger: ack, DeliveryTag: 1}, c.err)
+
+		if e, a := c.expectedAcks, len(ack.acks); e != a {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+		if e, a := c.expectedRequeue, ack.requeue; !reflect.DeepEqual(e, a) {
+			t.Errorf("case %d, expected %v, but received %v", i, e, a)
+		}
+	}
+}
+
+func TestConsumer_RetryAndDeadLetter(t *testing.T) {
+	c := newTestConnection(t)
+
+	name := fmt.Sprintf("sdk-go-test-retry-%d", time.Now().UnixNano())
+	dlq := name + ".dlq"
+	var calls int32
+	cs, err := NewConsumer(c, Queue{Name: name, AutoDelete: true}, func(ctx context.Context, d amqp.Delivery) error {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			panic("boom")
+		}
+		return errors.New("failure")
+	}, WithRetry(3, time.Millisecond*50, time.Millisecond*100), WithDeadLetterQueue(dlq))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cs.Shutdown(context.TODO())
+		for _, retryQueue := range RetryQueueNames(name, 3, time.Millisecond*50, time.Millisecond*100) {
+			assertMessages(t, c, retryQueue, 0)
+		}
+	})
+
+	err = c.PublishWithConfirm(context.TODO(), "", name, true, amqp.Publishing{MessageId: "retry", Body: []byte("retry")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := c.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Close()
+	defer ch.QueueDelete(dlq, false, false, false)
+
+	var d amqp.Delivery
+	for i := 0; ; i++ {
+		var ok bool
+		d, ok, err = ch.Get(dlq, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			break
+		}
+		if i == 100 {
+			t.Fatal("expected a dead lettered message")
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	if e, a := int32(3), atomic.LoadInt32(&calls); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := 3, Attempts(d); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := "failure", d.Headers[ErrorHeader]; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := name, d.Headers[QueueHeader]; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if _, ok := d.Headers[FailedAtHeader].(time.Time); !ok {
+		t.Errorf("expected the time of the failure, but received %v", d.Headers[FailedAtHeader])
+	}
+	if e, a := "retry", d.MessageId; e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
@@ -0,0 +1,288 @@
+package rabbitMQ
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type Exchange struct {
+	Name string
+	// Kind is direct, fanout, topic or headers
+	Kind       string
+	Durable    bool
+	AutoDelete bool
+	Internal   bool
+	Args       amqp.Table
+}
+
+type Queue struct {
+	Name       string
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+	Args       amqp.Table
+}
+
+type Binding struct {
+	Queue    string
+	Key      string
+	Exchange string
+	Args     amqp.Table
+}
+
+// ExchangeBinding routes the messages of the source exchange to the destination exchange.
+type ExchangeBinding struct {
+	Destination string
+	Key         string
+	Source      string
+	Args        amqp.Table
+}
+
+// topology is what was declared through a Connection, in order, to declare it again after reconnecting.
+type topology struct {
+	exchanges []Exchange
+	queues    []Queue
+	bindings  []Binding
+
+	exchangeBindings []ExchangeBinding
+}
+
+// DeclareExchange declares the exchange now and again after every reconnection.
+func (c *Connection) DeclareExchange(exchange Exchange) error {
+	return c.declare(func(ch *amqp.Channel) error {
+		return declareExchange(ch, exchange)
+	}, func(t *topology) {
+		for i, e := range t.exchanges {
+			if e.Name == exchange.Name {
+				t.exchanges[i] = exchange
+				return
+			}
+		}
+		t.exchanges = append(t.exchanges, exchange)
+	})
+}
+
+// DeclareQueue declares the queue now and again after every reconnection.
+// A queue named by the broker is not declared again, as it would get another name.
+func (c *Connection) DeclareQueue(queue Queue) (amqp.Queue, error) {
+	var q amqp.Queue
+	err := c.declare(func(ch *amqp.Channel) error {
+		var err error
+		q, err = declareQueue(ch, queue)
+		return err
+	}, func(t *topology) {
+		if queue.Name == "" {
+			return
+		}
+		for i, e := range t.queues {
+			if e.Name == queue.Name {
+				t.queues[i] = queue
+				return
+			}
+		}
+		t.queues = append(t.queues, queue)
+	})
+	return q, err
+}
+
+// BindQueue binds the queue now and again after every reconnection.
+func (c *Connection) BindQueue(binding Binding) error {
+	return c.declare(func(ch *amqp.Channel) error {
+		return bindQueue(ch, binding)
+	}, func(t *topology) {
+		for _, b := range t.bindings {
+			if b.Queue == binding.Queue && b.Key == binding.Key && b.Exchange == binding.Exchange {
+				return
+			}
+		}
+		t.bindings = append(t.bindings, binding)
+	})
+}
+
+// BindExchange binds the exchanges now and again after every reconnection.
+func (c *Connection) BindExchange(binding ExchangeBinding) error {
+	return c.declare(func(ch *amqp.Channel) error {
+		return bindExchange(ch, binding)
+	}, func(t *topology) {
+		for _, b := range t.exchangeBindings {
+			if b.Destination == binding.Destination && b.Key == binding.Key && b.Source == binding.Source {
+				return
+			}
+		}
+		t.exchangeBindings = append(t.exchangeBindings, binding)
+	})
+}
+
+// DeleteQueue deletes the queue and forgets it with its bindings, so that it is not declared again after
+// reconnecting. It returns the number of the messages deleted with the queue.
+func (c *Connection) DeleteQueue(name string) (int, error) {
+	var count int
+	err := c.declare(func(ch *amqp.Channel) error {
+		var err error
+		count, err = ch.QueueDelete(name, false, false, false)
+		return err
+	}, func(t *topology) {
+		t.forgetQueue(name)
+	})
+	return count, err
+}
+
+// DeleteExchange deletes the exchange and forgets it with its bindings, so that it is not declared again
+// after reconnecting.
+func (c *Connection) DeleteExchange(name string) error {
+	return c.declare(func(ch *amqp.Channel) error {
+		return ch.ExchangeDelete(name, false, false)
+	}, func(t *topology) {
+		t.forgetExchange(name)
+	})
+}
+
+func (t *topology) forgetQueue(name string) {
+	queues := t.queues[:0]
+	for _, q := range t.queues {
+		if q.Name != name {
+			queues = append(queues, q)
+		}
+	}
+	t.queues = queues
+
+	bindings := t.bindings[:0]
+	for _, b := range t.bindings {
+		if b.Queue != name {
+			bindings = append(bindings, b)
+		}
+	}
+	t.bindings = bindings
+}
+
+func (t *topology) forgetExchange(name string) {
+	exchanges := t.exchanges[:0]
+	for _, e := range t.exchanges {
+		if e.Name != name {
+			exchanges = append(exchanges, e)
+		}
+	}
+	t.exchanges = exchanges
+
+	bindings := t.bindings[:0]
+	for _, b := range t.bindings {
+		if b.Exchange != name {
+			bindings = append(bindings, b)
+		}
+	}
+	t.bindings = bindings
+
+	exchangeBindings := t.exchangeBindings[:0]
+	for _, b := range t.exchangeBindings {
+		if b.Source != name && b.Destination != name {
+			exchangeBindings = append(exchangeBindings, b)
+		}
+	}
+	t.exchangeBindings = exchangeBindings
+}
+
+// declare runs fn on a new channel and records the declaration once it succeeded.
+func (c *Connection) declare(fn func(ch *amqp.Channel) error, record func(t *topology)) error {
+	ch, err := c.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	err = fn(ch)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	record(&c.topology)
+	c.mu.Unlock()
+	return nil
+}
+
+// declareTopology declares the known topology on conn, which is not the current connection yet.
+func (c *Connection) declareTopology(conn *amqp.Connection) error {
+	c.mu.Lock()
+	t := topology{
+		exchanges: append([]Exchange(nil), c.topology.exchanges...),
+		queues:    append([]Queue(nil), c.topology.queues...),
+		bindings:  append([]Binding(nil), c.topology.bindings...),
+
+		exchangeBindings: append([]ExchangeBinding(nil), c.topology.exchangeBindings...),
+	}
+	c.mu.Unlock()
+
+	if len(t.exchanges)+len(t.queues)+len(t.bindings)+len(t.exchangeBindings) == 0 {
+		return nil
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for _, exchange := range t.exchanges {
+		if err := declareExchange(ch, exchange); err != nil {
+			return err
+		}
+	}
+	for _, queue := range t.queues {
+		if _, err := declareQueue(ch, queue); err != nil {
+			return err
+		}
+	}
+	for _, binding := range t.bindings {
+		if err := bindQueue(ch, binding); err != nil {
+			return err
+		}
+	}
+	for _, binding := range t.exchangeBindings {
+		if err := bindExchange(ch, binding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func declareExchange(ch *amqp.Channel, exchange Exchange) error {
+	return ch.ExchangeDeclare(
+		exchange.Name,
+		exchange.Kind,
+		exchange.Durable,
+		exchange.AutoDelete,
+		exchange.Internal,
+		false,
+		exchange.Args,
+	)
+}
+
+func declareQueue(ch *amqp.Channel, queue Queue) (amqp.Queue, error) {
+	return ch.QueueDeclare(
+		queue.Name,
+		queue.Durable,
+		queue.AutoDelete,
+		queue.Exclusive,
+		false,
+		queue.Args,
+	)
+}
+
+func bindQueue(ch *amqp.Channel, binding Binding) error {
+	return ch.QueueBind(
+		binding.Queue,
+		binding.Key,
+		binding.Exchange,
+		false,
+		binding.Args,
+	)
+}
+
+func bindExchange(ch *amqp.Channel, binding ExchangeBinding) error {
+	return ch.ExchangeBind(
+		binding.Destination,
+		binding.Key,
+		binding.Source,
+		false,
+		binding.Args,
+	)
+}
@@ -0,0 +1,41 @@
+package rabbitMQ
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopology_Forget(t *testing.T) {
+	tp := topology{
+		exchanges: []Exchange{{Name: "x"}, {Name: "y"}},
+		queues:    []Queue{{Name: "q"}, {Name: "r"}},
+		bindings: []Binding{
+			{Queue: "q", Exchange: "x"},
+			{Queue: "r", Exchange: "x"},
+			{Queue: "r", Exchange: "y"},
+		},
+		exchangeBindings: []ExchangeBinding{
+			{Destination: "x", Source: "y"},
+			{Destination: "y", Source: "z"},
+		},
+	}
+
+	tp.forgetQueue("q")
+	if e, a := []Queue{{Name: "r"}}, tp.queues; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := []Binding{{Queue: "r", Exchange: "x"}, {Queue: "r", Exchange: "y"}}, tp.bindings; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	tp.forgetExchange("x")
+	if e, a := []Exchange{{Name: "y"}}, tp.exchanges; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := []Binding{{Queue: "r", Exchange: "y"}}, tp.bindings; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if e, a := []ExchangeBinding{{Destination: "y", Source: "z"}}, tp.exchangeBindings; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
@@ -3,6 +3,7 @@ package ticker
 import (
 	"fmt"
 	"runtime/debug"
+	"sync"
 	"time"
 )
 
@@ -12,6 +13,9 @@ type Ticker struct {
 	interval time.Duration
 	ticker   *time.Ticker
 	runner   Runner
+	// done is closed by Stop, as stopping the time.Ticker does not close its channel
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
 func New(interval time.Duration, runner Runner) *Ticker {
@@ -19,6 +23,7 @@ func New(interval time.Duration, runner Runner) *Ticker {
 		interval: interval,
 		ticker:   time.NewTicker(interval),
 		runner:   runner,
+		done:     make(chan struct{}),
 	}
 }
 
@@ -31,14 +36,23 @@ func (t *Ticker) Start() {
 				fmt.Println(e)
 			}
 		}()
-		for range t.ticker.C {
-			t.runner()
+		for {
+			select {
+			case <-t.ticker.C:
+				t.runner()
+			case <-t.done:
+				return
+			}
 		}
 	}()
 }
 
+// Stop stops the ticker and its goroutine, the runner is not called afterwards unless it is running.
 func (t *Ticker) Stop() {
-	t.ticker.Stop()
+	t.stopOnce.Do(func() {
+		t.ticker.Stop()
+		close(t.done)
+	})
 }
 
 func (t *Ticker) Reset(d time.Duration) time.Duration {
@@ -0,0 +1,39 @@
+package ticker
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTicker_Stop(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	var runs int32
+	ticker := New(time.Millisecond*10, func() {
+		atomic.AddInt32(&runs, 1)
+	})
+	ticker.Start()
+	time.Sleep(time.Millisecond * 50)
+	ticker.Stop()
+	ticker.Stop()
+
+	// the goroutine of the ticker exits
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if e, a := before, runtime.NumGoroutine(); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	stopped := atomic.LoadInt32(&runs)
+	if stopped == 0 {
+		t.Errorf("expected the runner to be called")
+	}
+	time.Sleep(time.Millisecond * 50)
+	if e, a := stopped, atomic.LoadInt32(&runs); e != a {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}